@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// unitSuffixes are the decimals implied by an integer argument's unit suffix, e.g. "1.5ether" or "10usdc".
+var unitSuffixes = map[string]int{
+	"wei":   0,
+	"gwei":  9,
+	"ether": 18,
+	"eth":   18,
+	"usdc":  tokenDecimals,
+	"token": tokenDecimals,
+}
+
+// splitTopLevel splits s on commas that are not nested in brackets or parentheses.
+func splitTopLevel(s string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced %q in %q", c, s)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced brackets in %q", s)
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" || len(parts) > 0 {
+		parts = append(parts, rest)
+	}
+	return parts, nil
+}
+
+// typeMarshaling converts a type string such as "uint256[]" or "(address,uint256)[2]" into the form
+// abi.NewType expects, spelling out tuple components.
+func typeMarshaling(t string) (abi.ArgumentMarshaling, error) {
+	t = strings.TrimSpace(t)
+	if !strings.HasPrefix(t, "(") {
+		return abi.ArgumentMarshaling{Type: t}, nil
+	}
+	end := strings.LastIndex(t, ")")
+	if end < 0 {
+		return abi.ArgumentMarshaling{}, fmt.Errorf("unbalanced tuple type %q", t)
+	}
+	elems, err := splitTopLevel(t[1:end])
+	if err != nil {
+		return abi.ArgumentMarshaling{}, err
+	}
+	m := abi.ArgumentMarshaling{Type: "tuple" + t[end+1:]}
+	for i, e := range elems {
+		c, err := typeMarshaling(e)
+		if err != nil {
+			return abi.ArgumentMarshaling{}, err
+		}
+		c.Name = fmt.Sprintf("field%d", i)
+		m.Components = append(m.Components, c)
+	}
+	return m, nil
+}
+
+// parseType parses a Solidity type string, including tuples written as "(type,...)".
+func parseType(t string) (abi.Type, error) {
+	m, err := typeMarshaling(t)
+	if err != nil {
+		return abi.Type{}, err
+	}
+	return abi.NewType(m.Type, "", m.Components)
+}
+
+// parseMethodSignature parses a signature such as "initializeV2(uint256,address)" into its name and
+// argument list.
+func parseMethodSignature(sig string) (string, abi.Arguments, error) {
+	name, rest, ok := strings.Cut(strings.ReplaceAll(sig, " ", ""), "(")
+	if !ok || !strings.HasSuffix(rest, ")") || name == "" {
+		return "", nil, fmt.Errorf("invalid method signature %q", sig)
+	}
+	types, err := splitTopLevel(strings.TrimSuffix(rest, ")"))
+	if err != nil {
+		return "", nil, err
+	}
+	var args abi.Arguments
+	for _, t := range types {
+		typ, err := parseType(t)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid type %q in %q: %w", t, sig, err)
+		}
+		args = append(args, abi.Argument{Type: typ})
+	}
+	return name, args, nil
+}
+
+// encodeMethodCall ABI-encodes a call to a method signature with string arguments.
+func encodeMethodCall(sig string, values []string) ([]byte, error) {
+	name, args, err := parseMethodSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := packArguments(args, values)
+	if err != nil {
+		return nil, err
+	}
+	types := make([]string, len(args))
+	for i, arg := range args {
+		types[i] = arg.Type.String()
+	}
+	selector := crypto.Keccak256([]byte(name + "(" + strings.Join(types, ",") + ")"))[:4]
+	return append(selector, packed...), nil
+}
+
+// packArguments parses string values according to an argument list and ABI-encodes them.
+func packArguments(args abi.Arguments, values []string) ([]byte, error) {
+	if len(values) != len(args) {
+		return nil, fmt.Errorf("expected %d arguments, got %d", len(args), len(values))
+	}
+	parsed := make([]interface{}, len(args))
+	for i, arg := range args {
+		var err error
+		if parsed[i], err = parseABIValue(arg.Type, values[i]); err != nil {
+			return nil, fmt.Errorf("argument %d (%s): %w", i+1, arg.Type.String(), err)
+		}
+	}
+	return args.Pack(parsed...)
+}
+
+// parseABIValue converts a string into the Go value go-ethereum expects for an ABI type.
+// Arrays are written as "[a,b]" and tuples as "(a,b)".
+func parseABIValue(typ abi.Type, s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	switch typ.T {
+	case abi.AddressTy:
+		if !common.IsHexAddress(s) {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		return common.HexToAddress(s), nil
+	case abi.BoolTy:
+		return strconv.ParseBool(s)
+	case abi.StringTy:
+		return s, nil
+	case abi.BytesTy:
+		return hexutil.Decode(s)
+	case abi.FixedBytesTy:
+		b, err := hexutil.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != typ.Size {
+			return nil, fmt.Errorf("expected %d bytes, got %d", typ.Size, len(b))
+		}
+		v := reflect.New(typ.GetType()).Elem()
+		reflect.Copy(v, reflect.ValueOf(b))
+		return v.Interface(), nil
+	case abi.UintTy, abi.IntTy:
+		n, err := parseInteger(s)
+		if err != nil {
+			return nil, err
+		}
+		return convertInteger(typ, n)
+	case abi.SliceTy, abi.ArrayTy:
+		if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("expected an array like [a,b], got %q", s)
+		}
+		elems, err := splitTopLevel(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		var v reflect.Value
+		if typ.T == abi.ArrayTy {
+			if len(elems) != typ.Size {
+				return nil, fmt.Errorf("expected %d elements, got %d", typ.Size, len(elems))
+			}
+			v = reflect.New(typ.GetType()).Elem()
+		} else {
+			v = reflect.MakeSlice(typ.GetType(), len(elems), len(elems))
+		}
+		for i, e := range elems {
+			elem, err := parseABIValue(*typ.Elem, e)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			v.Index(i).Set(reflect.ValueOf(elem))
+		}
+		return v.Interface(), nil
+	case abi.TupleTy:
+		if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+			return nil, fmt.Errorf("expected a tuple like (a,b), got %q", s)
+		}
+		elems, err := splitTopLevel(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		if len(elems) != len(typ.TupleElems) {
+			return nil, fmt.Errorf("expected %d tuple fields, got %d", len(typ.TupleElems), len(elems))
+		}
+		v := reflect.New(typ.GetType()).Elem()
+		for i, e := range elems {
+			field, err := parseABIValue(*typ.TupleElems[i], e)
+			if err != nil {
+				return nil, fmt.Errorf("field %d: %w", i, err)
+			}
+			v.Field(i).Set(reflect.ValueOf(field))
+		}
+		return v.Interface(), nil
+	}
+	return nil, fmt.Errorf("unsupported argument type %s", typ.String())
+}
+
+// parseInteger parses a decimal or 0x-prefixed integer, an exponent such as "1e18", or a decimal amount
+// with a unit suffix such as "1.5ether", "2gwei" or "10usdc".
+func parseInteger(s string) (*big.Int, error) {
+	neg := strings.HasPrefix(s, "-")
+	body := strings.TrimPrefix(s, "-")
+	var n *big.Int
+	var err error
+	switch lower := strings.ToLower(body); {
+	case strings.HasPrefix(lower, "0x"):
+		var ok bool
+		if n, ok = new(big.Int).SetString(lower[2:], 16); !ok {
+			err = fmt.Errorf("invalid integer %q", s)
+		}
+	case strings.ContainsAny(lower, "abcdfghijklmnopqrstuvwxyz"):
+		number := strings.TrimRight(lower, "abcdefghijklmnopqrstuvwxyz")
+		decimals, ok := unitSuffixes[lower[len(number):]]
+		if !ok {
+			return nil, fmt.Errorf("unknown unit in %q (known: wei, gwei, ether, usdc, token)", s)
+		}
+		n, err = parseUnits(number, decimals)
+	case strings.Contains(lower, "e"):
+		mantissa, exp, _ := strings.Cut(lower, "e")
+		decimals, convErr := strconv.Atoi(exp)
+		if convErr != nil || decimals < 0 || decimals > 77 {
+			return nil, fmt.Errorf("invalid exponent in %q", s)
+		}
+		n, err = parseUnits(mantissa, decimals)
+	default:
+		n, err = parseUnits(lower, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if neg {
+		n.Neg(n)
+	}
+	return n, nil
+}
+
+// convertInteger range-checks an integer and converts it to the Go type used for the ABI type.
+func convertInteger(typ abi.Type, n *big.Int) (interface{}, error) {
+	if typ.T == abi.UintTy && n.Sign() < 0 {
+		return nil, fmt.Errorf("negative value %s for %s", n, typ.String())
+	}
+	// uintN holds [0, 2^N-1] and intN holds [-2^(N-1), 2^(N-1)-1].
+	lo, hi := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(typ.Size))
+	if typ.T == abi.IntTy {
+		hi.Rsh(hi, 1)
+		lo.Neg(hi)
+	}
+	hi.Sub(hi, big.NewInt(1))
+	if n.Cmp(lo) < 0 || n.Cmp(hi) > 0 {
+		return nil, fmt.Errorf("value %s overflows %s", n, typ.String())
+	}
+	if typ.Size > 64 {
+		return n, nil
+	}
+	switch {
+	case typ.T == abi.UintTy && typ.Size == 8:
+		return uint8(n.Uint64()), nil
+	case typ.T == abi.UintTy && typ.Size == 16:
+		return uint16(n.Uint64()), nil
+	case typ.T == abi.UintTy && typ.Size == 32:
+		return uint32(n.Uint64()), nil
+	case typ.T == abi.UintTy && typ.Size == 64:
+		return n.Uint64(), nil
+	case typ.T == abi.IntTy && typ.Size == 8:
+		return int8(n.Int64()), nil
+	case typ.T == abi.IntTy && typ.Size == 16:
+		return int16(n.Int64()), nil
+	case typ.T == abi.IntTy && typ.Size == 32:
+		return int32(n.Int64()), nil
+	case typ.T == abi.IntTy && typ.Size == 64:
+		return n.Int64(), nil
+	}
+	// Odd sizes such as uint24 are packed from *big.Int.
+	return n, nil
+}
+
+// formatABIValue renders a decoded ABI value: integers in decimal, byte strings in hex, arrays as
+// "[a, b]" and tuples as "(a, b)".
+func formatABIValue(v interface{}) string {
+	switch x := v.(type) {
+	case *big.Int:
+		return x.String()
+	case common.Address:
+		return x.Hex()
+	case common.Hash:
+		return x.Hex()
+	case []byte:
+		return hexutil.Encode(x)
+	case string:
+		return strconv.Quote(x)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return hexutil.Encode(b)
+		}
+		fallthrough
+	case reflect.Slice:
+		elems := make([]string, rv.Len())
+		for i := range elems {
+			elems[i] = formatABIValue(rv.Index(i).Interface())
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case reflect.Struct:
+		fields := make([]string, rv.NumField())
+		for i := range fields {
+			fields[i] = rv.Type().Field(i).Name + ": " + formatABIValue(rv.Field(i).Interface())
+		}
+		return "(" + strings.Join(fields, ", ") + ")"
+	}
+	return fmt.Sprint(v)
+}
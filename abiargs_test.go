@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+func TestConvertInteger(t *testing.T) {
+	tests := []struct {
+		typ     string
+		value   string
+		want    interface{}
+		wantErr bool
+	}{
+		{"uint8", "0", uint8(0), false},
+		{"uint8", "255", uint8(255), false},
+		{"uint8", "256", nil, true},
+		{"uint8", "-1", nil, true},
+		{"int8", "-128", int8(-128), false},
+		{"int8", "127", int8(127), false},
+		{"int8", "128", nil, true},
+		{"int8", "-129", nil, true},
+		{"int16", "-32768", int16(-32768), false},
+		{"int32", "-2147483648", int32(-2147483648), false},
+		{"int64", "-9223372036854775808", int64(-9223372036854775808), false},
+		{"int64", "9223372036854775808", nil, true},
+		{"uint64", "18446744073709551615", uint64(18446744073709551615), false},
+		{"uint24", "16777215", big.NewInt(16777215), false},
+		{"uint24", "16777216", nil, true},
+		{"int256", "-57896044618658097711785492504343953926634992332820282019728792003956564819968", nil, false},
+		{"int256", "57896044618658097711785492504343953926634992332820282019728792003956564819968", nil, true},
+		{"uint256", "115792089237316195423570985008687907853269984665640564039457584007913129639935", nil, false},
+		{"uint256", "115792089237316195423570985008687907853269984665640564039457584007913129639936", nil, true},
+	}
+	for _, tt := range tests {
+		typ, err := abi.NewType(tt.typ, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := new(big.Int).SetString(tt.value, 10)
+		got, err := convertInteger(typ, n)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("convertInteger(%s, %s) error = %v, wantErr %v", tt.typ, tt.value, err, tt.wantErr)
+			continue
+		}
+		if err != nil || tt.want == nil {
+			continue
+		}
+		if want, ok := tt.want.(*big.Int); ok {
+			if got.(*big.Int).Cmp(want) != 0 {
+				t.Errorf("convertInteger(%s, %s) = %v, want %v", tt.typ, tt.value, got, want)
+			}
+		} else if got != tt.want {
+			t.Errorf("convertInteger(%s, %s) = %#v, want %#v", tt.typ, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseInteger(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"42", "42", false},
+		{"0x2a", "42", false},
+		{"-5", "-5", false},
+		{"1e18", "1000000000000000000", false},
+		{"1.5ether", "1500000000000000000", false},
+		{"2gwei", "2000000000", false},
+		{"250usdc", "250000000", false},
+		{"abc", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseInteger(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseInteger(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("parseInteger(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
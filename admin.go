@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// adminUsage lists the admin subcommands.
+const adminUsage = "Usage: admin <owner|transfer-ownership|renounce-ownership|upgrade|initialize> [flags]"
+
+// runAdmin implements the admin subcommand group. readOpts pins read-only subcommands to the global --block/--at.
+func runAdmin(client *ethclient.Client, lending *defi.Defi, readOpts func() (*bind.CallOpts, *types.Header), args []string) {
+	if len(args) == 0 {
+		fmt.Println(adminUsage)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "owner":
+		opts, _ := readOpts()
+		owner, err := lending.Owner(opts)
+		if err != nil {
+			log.Fatal("Failed to get owner:", err)
+		}
+		fmt.Println("Owner:", owner.Hex())
+	case "transfer-ownership":
+		adminTransferOwnership(client, lending, args[1:])
+	case "renounce-ownership":
+		adminRenounceOwnership(client, lending, args[1:])
+	case "upgrade":
+		adminUpgrade(client, lending, args[1:])
+	case "initialize":
+		adminInitialize(client, lending, args[1:])
+	default:
+		fmt.Println(adminUsage)
+		os.Exit(1)
+	}
+}
+
+// adminTransferOwnership transfers ownership after checksum, code and signer checks and a confirmation prompt.
+func adminTransferOwnership(client *ethclient.Client, lending *defi.Defi, args []string) {
+	transferCmd := flag.NewFlagSet("admin transfer-ownership", flag.ExitOnError)
+	newOwnerFlag := transferCmd.String("new-owner", "", "Address of the new owner, EIP-55 checksummed if mixed-case")
+	privateKeyFlag := transferCmd.String("private-key", "", "Private key of the current owner")
+	allowEOAFlag := transferCmd.Bool("allow-eoa", false, "Allow a new owner without contract code (an EOA or an undeployed contract)")
+	yesFlag := transferCmd.Bool("yes", false, "Skip the confirmation prompt")
+	transferCmd.Parse(args)
+
+	if *newOwnerFlag == "" || *privateKeyFlag == "" {
+		fmt.Println("Usage: admin transfer-ownership --new-owner <address> --private-key <private-key> [--allow-eoa] [--yes]")
+		os.Exit(1)
+	}
+	newOwner, err := parseChecksummedAddress(*newOwnerFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if newOwner == (common.Address{}) {
+		log.Fatal("New owner cannot be the zero address; use renounce-ownership instead")
+	}
+
+	ctx := context.Background()
+	code, err := client.CodeAt(ctx, newOwner, nil)
+	if err != nil {
+		log.Fatal("Failed to get code of new owner:", err)
+	}
+	if len(code) == 0 && !*allowEOAFlag {
+		log.Fatalf("New owner %s has no contract code; pass --allow-eoa if it is an EOA or a contract that is not deployed yet", newOwner.Hex())
+	}
+
+	auth, currentOwner := ownerTransactor(client, lending, *privateKeyFlag)
+	fmt.Printf("Transfer ownership of %s\n  from %s\n  to   %s (code: %d bytes)\n", contractAddress, currentOwner.Hex(), newOwner.Hex(), len(code))
+	assumeYes = *yesFlag
+
+	tx, err := lending.TransferOwnership(auth, newOwner)
+	if err != nil {
+		log.Fatal("Failed to transfer ownership:", err)
+	}
+	fmt.Println("TransferOwnership transaction sent, tx hash:", tx.Hash().Hex())
+	waitOwnershipTransferred(ctx, client, lending, tx)
+}
+
+// adminRenounceOwnership renounces ownership, which requires two explicit confirmation flags.
+func adminRenounceOwnership(client *ethclient.Client, lending *defi.Defi, args []string) {
+	renounceCmd := flag.NewFlagSet("admin renounce-ownership", flag.ExitOnError)
+	privateKeyFlag := renounceCmd.String("private-key", "", "Private key of the current owner")
+	confirmFlag := renounceCmd.Bool("confirm", false, "Confirm renouncing ownership")
+	irreversibleFlag := renounceCmd.Bool("confirm-irreversible", false, "Confirm that the contract will have no owner and can never be upgraded again")
+	yesFlag := renounceCmd.Bool("yes", false, "Skip the confirmation prompt")
+	renounceCmd.Parse(args)
+
+	if *privateKeyFlag == "" || !*confirmFlag || !*irreversibleFlag {
+		fmt.Println("Usage: admin renounce-ownership --private-key <private-key> --confirm --confirm-irreversible [--yes]")
+		fmt.Println("Renouncing ownership is irreversible: owner-only functions, including upgrades, become unusable.")
+		os.Exit(1)
+	}
+	auth, currentOwner := ownerTransactor(client, lending, *privateKeyFlag)
+	fmt.Printf("Renouncing ownership of %s held by %s\n", contractAddress, currentOwner.Hex())
+	assumeYes = *yesFlag
+
+	tx, err := lending.RenounceOwnership(auth)
+	if err != nil {
+		log.Fatal("Failed to renounce ownership:", err)
+	}
+	fmt.Println("RenounceOwnership transaction sent, tx hash:", tx.Hash().Hex())
+	waitOwnershipTransferred(context.Background(), client, lending, tx)
+}
+
+// adminUpgrade upgrades the UUPS proxy after checking the new implementation and simulating the call.
+func adminUpgrade(client *ethclient.Client, lending *defi.Defi, args []string) {
+	upgradeCmd := flag.NewFlagSet("admin upgrade", flag.ExitOnError)
+	implFlag := upgradeCmd.String("implementation", "", "Address of the new implementation, EIP-55 checksummed if mixed-case")
+	privateKeyFlag := upgradeCmd.String("private-key", "", "Private key of the current owner")
+	initSigFlag := upgradeCmd.String("init-sig", "", "Optional initializer to call after upgrading (e.g., \"initializeV2(uint256)\")")
+	initArgsFlag := upgradeCmd.String("init-args", "", "Comma-separated arguments for --init-sig")
+	yesFlag := upgradeCmd.Bool("yes", false, "Skip the confirmation prompt")
+	upgradeCmd.Parse(args)
+
+	if *implFlag == "" || *privateKeyFlag == "" {
+		fmt.Println("Usage: admin upgrade --implementation <address> --private-key <private-key> [--init-sig <signature> --init-args <args>] [--yes]")
+		os.Exit(1)
+	}
+	impl, err := parseChecksummedAddress(*implFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var initData []byte
+	if *initSigFlag != "" {
+		values, err := splitTopLevel(*initArgsFlag)
+		if err != nil {
+			log.Fatal("Invalid --init-args:", err)
+		}
+		if initData, err = encodeMethodCall(*initSigFlag, values); err != nil {
+			log.Fatal("Failed to encode initializer:", err)
+		}
+	} else if *initArgsFlag != "" {
+		log.Fatal("--init-args requires --init-sig")
+	}
+
+	ctx := context.Background()
+	proxy := common.HexToAddress(contractAddress)
+	code, err := client.CodeAt(ctx, impl, nil)
+	if err != nil {
+		log.Fatal("Failed to get code of implementation:", err)
+	}
+	if len(code) == 0 {
+		log.Fatalf("Implementation %s has no contract code", impl.Hex())
+	}
+	// A UUPS implementation must report the ERC-1967 slot, otherwise upgradeToAndCall reverts
+	// with UUPSUnsupportedProxiableUUID (or the proxy is bricked by an implementation without upgrade logic).
+	candidate, err := defi.NewDefiCaller(impl, client)
+	if err != nil {
+		log.Fatal("Failed to bind implementation:", err)
+	}
+	uuid, err := candidate.ProxiableUUID(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		log.Fatalf("Implementation %s does not implement proxiableUUID(); it is not a UUPS implementation: %v", impl.Hex(), err)
+	}
+	if common.Hash(uuid) != erc1967ImplementationSlot {
+		log.Fatalf("Implementation %s returned proxiableUUID %s, expected %s", impl.Hex(), common.Hash(uuid).Hex(), erc1967ImplementationSlot.Hex())
+	}
+	current, err := readAddressSlot(ctx, client, proxy, erc1967ImplementationSlot, nil)
+	if err != nil {
+		log.Fatal("Failed to read implementation slot:", err)
+	}
+	if current == impl {
+		log.Fatalf("Proxy already points at %s", impl.Hex())
+	}
+
+	auth, owner := ownerTransactor(client, lending, *privateKeyFlag)
+	parsedABI, err := defi.DefiMetaData.GetAbi()
+	if err != nil {
+		log.Fatal("Failed to load lending ABI:", err)
+	}
+	calldata, err := parsedABI.Pack("upgradeToAndCall", impl, initData)
+	if err != nil {
+		log.Fatal("Failed to encode upgradeToAndCall:", err)
+	}
+	if _, err := client.CallContract(ctx, ethereum.CallMsg{From: owner, To: &proxy, Data: calldata}, nil); err != nil {
+		log.Fatal("Upgrade simulation reverted:", err)
+	}
+
+	fmt.Printf("Upgrade proxy %s\n  from %s\n  to   %s (code: %d bytes)\n", proxy.Hex(), current.Hex(), impl.Hex(), len(code))
+	if len(initData) > 0 {
+		fmt.Printf("  then call %s (calldata 0x%x)\n", *initSigFlag, initData)
+	}
+	fmt.Println("Simulation succeeded")
+	assumeYes = *yesFlag
+
+	tx, err := lending.UpgradeToAndCall(auth, impl, initData)
+	if err != nil {
+		log.Fatal("Failed to upgrade:", err)
+	}
+	fmt.Println("UpgradeToAndCall transaction sent, tx hash:", tx.Hash().Hex())
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		log.Fatal("Failed to wait for transaction:", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		log.Fatal("Transaction reverted in block ", receipt.BlockNumber)
+	}
+	upgraded := false
+	for _, l := range receipt.Logs {
+		if evt, err := lending.ParseUpgraded(*l); err == nil && l.Address == proxy {
+			fmt.Println("Upgraded:", evt.Implementation.Hex())
+			upgraded = upgraded || evt.Implementation == impl
+		}
+	}
+	if !upgraded {
+		log.Fatal("No Upgraded event for the new implementation in the receipt")
+	}
+	stored, err := readAddressSlot(ctx, client, proxy, erc1967ImplementationSlot, receipt.BlockNumber)
+	if err != nil {
+		log.Fatal("Failed to read implementation slot:", err)
+	}
+	if stored != impl {
+		log.Fatalf("Implementation slot holds %s, expected %s", stored.Hex(), impl.Hex())
+	}
+	fmt.Println("Implementation slot is now:", stored.Hex())
+}
+
+// adminInitialize initializes a freshly deployed proxy. Until it is initialized anyone can call initialize
+// and become the owner, so the command checks the proxy is uninitialized, simulates the call, and verifies
+// afterwards that the signer, not a front-runner, ended up as owner.
+func adminInitialize(client *ethclient.Client, lending *defi.Defi, args []string) {
+	initCmd := flag.NewFlagSet("admin initialize", flag.ExitOnError)
+	tokenFlag := initCmd.String("token", "", "Address of the ERC20 token the market lends, EIP-55 checksummed if mixed-case")
+	privateKeyFlag := initCmd.String("private-key", "", "Private key of the account that becomes the owner")
+	yesFlag := initCmd.Bool("yes", false, "Skip the confirmation prompt")
+	initCmd.Parse(args)
+
+	if *tokenFlag == "" || *privateKeyFlag == "" {
+		fmt.Println("Usage: admin initialize --token <address> --private-key <private-key> [--yes]")
+		os.Exit(1)
+	}
+	token, err := parseChecksummedAddress(*tokenFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	proxy := common.HexToAddress(contractAddress)
+	version, initializing, err := readInitializable(ctx, client, proxy, nil)
+	if err != nil {
+		log.Fatal("Failed to read initializable slot:", err)
+	}
+	if version != 0 || initializing {
+		log.Fatalf("Proxy %s is already initialized (version %d)", proxy.Hex(), version)
+	}
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		log.Fatal("Failed to get block number:", err)
+	}
+	// The slot is authoritative; with a known deploy block the event history is cheap enough to cross-check.
+	if activeProfile != nil && activeProfile.DeployBlock > 0 {
+		if block, found, err := findInitialized(ctx, lending, activeProfile.DeployBlock, head); err != nil {
+			log.Fatal("Failed to search Initialized events:", err)
+		} else if found {
+			log.Fatalf("Proxy %s emitted Initialized in block %d; it is already initialized", proxy.Hex(), block)
+		}
+	}
+
+	code, err := client.CodeAt(ctx, token, nil)
+	if err != nil {
+		log.Fatal("Failed to get token code:", err)
+	}
+	if len(code) == 0 {
+		log.Fatalf("Token %s has no contract code", token.Hex())
+	}
+	erc20, err := usdc.NewUsdcCaller(token, client)
+	if err != nil {
+		log.Fatal("Failed to bind token:", err)
+	}
+	callOpts := &bind.CallOpts{Context: ctx}
+	decimals, err := erc20.Decimals(callOpts)
+	if err != nil {
+		log.Fatalf("Token %s does not implement decimals(): %v", token.Hex(), err)
+	}
+	symbol, err := erc20.Symbol(callOpts)
+	if err != nil {
+		log.Fatalf("Token %s does not implement symbol(): %v", token.Hex(), err)
+	}
+	if _, err := erc20.TotalSupply(callOpts); err != nil {
+		log.Fatalf("Token %s does not implement totalSupply(): %v", token.Hex(), err)
+	}
+	if decimals > 36 || strings.TrimSpace(symbol) == "" {
+		log.Fatalf("Token %s reports implausible metadata: symbol %q, %d decimals", token.Hex(), symbol, decimals)
+	}
+
+	auth, err := chainTransactor(client, *privateKeyFlag)
+	if err != nil {
+		log.Fatal("Failed to create transactor:", err)
+	}
+	parsedABI, err := defi.DefiMetaData.GetAbi()
+	if err != nil {
+		log.Fatal("Failed to load lending ABI:", err)
+	}
+	calldata, err := parsedABI.Pack("initialize", token)
+	if err != nil {
+		log.Fatal("Failed to encode initialize:", err)
+	}
+	if _, err := client.CallContract(ctx, ethereum.CallMsg{From: auth.From, To: &proxy, Data: calldata}, nil); err != nil {
+		log.Fatal("Initialize simulation reverted:", err)
+	}
+
+	fmt.Printf("Initialize proxy %s\n  token %s (%s, %d decimals)\n  owner %s\n", proxy.Hex(), token.Hex(), symbol, decimals, auth.From.Hex())
+	if decimals != tokenDecimals {
+		fmt.Printf("WARNING: this CLI formats amounts with %d decimals, the token has %d\n", tokenDecimals, decimals)
+	}
+	if token != common.HexToAddress(usdcContractAddress) {
+		fmt.Printf("WARNING: token differs from the configured uSDC address %s\n", usdcContractAddress)
+	}
+	assumeYes = *yesFlag
+
+	tx, err := lending.Initialize(auth, token)
+	if err != nil {
+		log.Fatal("Failed to initialize:", err)
+	}
+	fmt.Println("Initialize transaction sent, tx hash:", tx.Hash().Hex())
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		log.Fatal("Failed to wait for transaction:", err)
+	}
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: receipt.BlockNumber}
+	owner, err := lending.Owner(opts)
+	if err != nil {
+		log.Fatal("Failed to get owner:", err)
+	}
+	configured, err := lending.Token(opts)
+	if err != nil {
+		log.Fatal("Failed to get token:", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		log.Fatalf("Transaction reverted in block %s; the proxy is now owned by %s with token %s (front-run?)", receipt.BlockNumber, owner.Hex(), configured.Hex())
+	}
+	fmt.Println("Owner:", owner.Hex())
+	fmt.Println("Token:", configured.Hex())
+	if owner != auth.From || configured != token {
+		log.Fatal("Proxy state does not match the initialize call")
+	}
+}
+
+// ownerTransactor creates a transactor and verifies the signer is the current owner,
+// avoiding a guaranteed OwnableUnauthorizedAccount revert.
+func ownerTransactor(client *ethclient.Client, lending *defi.Defi, privateKeyHex string) (*bind.TransactOpts, common.Address) {
+	auth, err := newTransactor(client, privateKeyHex)
+	if err != nil {
+		log.Fatal("Failed to create transactor:", err)
+	}
+	owner, err := lending.Owner(&bind.CallOpts{})
+	if err != nil {
+		log.Fatal("Failed to get owner:", err)
+	}
+	if owner != auth.From {
+		log.Fatalf("Signer %s is not the owner %s; the call would revert with OwnableUnauthorizedAccount", auth.From.Hex(), owner.Hex())
+	}
+	return auth, owner
+}
+
+// waitOwnershipTransferred waits for a transaction and prints its OwnershipTransferred event and the new owner.
+func waitOwnershipTransferred(ctx context.Context, client *ethclient.Client, lending *defi.Defi, tx *types.Transaction) {
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		log.Fatal("Failed to wait for transaction:", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		log.Fatal("Transaction reverted in block ", receipt.BlockNumber)
+	}
+	for _, l := range receipt.Logs {
+		if evt, err := lending.ParseOwnershipTransferred(*l); err == nil {
+			fmt.Printf("OwnershipTransferred: %s -> %s\n", evt.PreviousOwner.Hex(), evt.NewOwner.Hex())
+		}
+	}
+	owner, err := lending.Owner(&bind.CallOpts{BlockNumber: receipt.BlockNumber})
+	if err != nil {
+		log.Fatal("Failed to get owner:", err)
+	}
+	fmt.Println("Owner is now:", owner.Hex())
+}
+
+// parseChecksummedAddress parses a hex address, verifying the EIP-55 checksum when it is mixed-case.
+func parseChecksummedAddress(s string) (common.Address, error) {
+	if !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("invalid address %q", s)
+	}
+	body := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if body != strings.ToLower(body) && body != strings.ToUpper(body) {
+		mixed, err := common.NewMixedcaseAddressFromString(s)
+		if err != nil {
+			return common.Address{}, err
+		}
+		if !mixed.ValidChecksum() {
+			return common.Address{}, fmt.Errorf("address %s has an invalid EIP-55 checksum (expected %s)", s, mixed.Address().Hex())
+		}
+	}
+	return common.HexToAddress(s), nil
+}
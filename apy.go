@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"defi-lending/defi"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// indexSample is the deposit index observed at a block.
+type indexSample struct {
+	Block uint64
+	Time  uint64
+	Index *big.Float
+}
+
+// indexSource returns the deposit index as of a block.
+type indexSource interface {
+	IndexAt(ctx context.Context, header *types.Header) (*indexSample, error)
+}
+
+// archiveIndexSource reads DepositIndex at historical blocks, which requires an archive node.
+type archiveIndexSource struct {
+	lending *defi.Defi
+}
+
+func (s *archiveIndexSource) IndexAt(ctx context.Context, header *types.Header) (*indexSample, error) {
+	index, err := s.lending.DepositIndex(&bind.CallOpts{Context: ctx, BlockNumber: header.Number})
+	if err != nil {
+		return nil, err
+	}
+	return &indexSample{Block: header.Number.Uint64(), Time: header.Time, Index: new(big.Float).SetInt(index)}, nil
+}
+
+// eventIndexSource derives the deposit index from the amount/shares ratio of Deposited and Withdrawn events.
+type eventIndexSource struct {
+	samples []indexSample // sorted by block
+}
+
+// newEventIndexSource indexes every Deposited and Withdrawn event in a block range.
+func newEventIndexSource(ctx context.Context, client *ethclient.Client, lending *defi.Defi, from, to uint64) (*eventIndexSource, error) {
+	s := &eventIndexSource{}
+	add := func(block uint64, amount, shares *big.Int) {
+		if shares.Sign() == 0 {
+			return
+		}
+		index := new(big.Float).SetInt(amount)
+		index.Mul(index, indexScale)
+		index.Quo(index, new(big.Float).SetInt(shares))
+		s.samples = append(s.samples, indexSample{Block: block, Index: index})
+	}
+	for start := from; start <= to; start += maxLogRange {
+		end := min(start+maxLogRange-1, to)
+		opts := &bind.FilterOpts{Start: start, End: &end, Context: ctx}
+		deposited, err := lending.FilterDeposited(opts, nil)
+		if err != nil {
+			return nil, err
+		}
+		for deposited.Next() {
+			add(deposited.Event.Raw.BlockNumber, deposited.Event.Amount, deposited.Event.Shares)
+		}
+		err = deposited.Error()
+		deposited.Close()
+		if err != nil {
+			return nil, err
+		}
+		withdrawn, err := lending.FilterWithdrawn(opts, nil)
+		if err != nil {
+			return nil, err
+		}
+		for withdrawn.Next() {
+			add(withdrawn.Event.Raw.BlockNumber, withdrawn.Event.Amount, withdrawn.Event.Shares)
+		}
+		err = withdrawn.Error()
+		withdrawn.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(s.samples, func(i, j int) bool { return s.samples[i].Block < s.samples[j].Block })
+	return s, nil
+}
+
+func (s *eventIndexSource) IndexAt(ctx context.Context, header *types.Header) (*indexSample, error) {
+	block := header.Number.Uint64()
+	i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].Block > block })
+	if i == 0 {
+		return nil, fmt.Errorf("no Deposited or Withdrawn event at or before block %d", block)
+	}
+	sample := s.samples[i-1]
+	return &indexSample{Block: block, Time: header.Time, Index: sample.Index}, nil
+}
+
+// deployBlock returns the block the lending proxy was deployed in: the active profile's deploy block, or else
+// the first block with contract code at the proxy address, found by bisection over historical state.
+func deployBlock(ctx context.Context, client *ethclient.Client, head uint64) (uint64, error) {
+	if activeProfile != nil && activeProfile.DeployBlock > 0 {
+		return activeProfile.DeployBlock, nil
+	}
+	proxy := common.HexToAddress(contractAddress)
+	hasCode := func(block uint64) (bool, error) {
+		code, err := client.CodeAt(ctx, proxy, new(big.Int).SetUint64(block))
+		if err != nil {
+			return false, fmt.Errorf("read code at block %d (needs an archive node; pass --from-block or select a profile with a deploy block): %w", block, err)
+		}
+		return len(code) > 0, nil
+	}
+	if ok, err := hasCode(head); err != nil {
+		return 0, err
+	} else if !ok {
+		return 0, fmt.Errorf("no contract code at %s", proxy.Hex())
+	}
+	lo, hi := uint64(0), head
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		ok, err := hasCode(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+// findInitialized returns the block of the lending contract's first Initialized event between from and head,
+// scanning in maxLogRange chunks; found is false if there is none.
+func findInitialized(ctx context.Context, lending *defi.Defi, from, head uint64) (block uint64, found bool, err error) {
+	for start := from; start <= head; start += maxLogRange {
+		end := min(start+maxLogRange-1, head)
+		it, err := lending.FilterInitialized(&bind.FilterOpts{Start: start, End: &end, Context: ctx})
+		if err != nil {
+			return 0, false, err
+		}
+		found := it.Next()
+		evt := it.Event
+		err = it.Error()
+		it.Close()
+		if err != nil {
+			return 0, false, err
+		}
+		if found {
+			return evt.Raw.BlockNumber, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// inceptionBlock returns the block of the lending contract's first Initialized event, searched from its deploy
+// block. It is the default start of commands that replay the contract's history.
+func inceptionBlock(ctx context.Context, client *ethclient.Client, lending *defi.Defi, head uint64) (uint64, error) {
+	from, err := deployBlock(ctx, client, head)
+	if err != nil {
+		return 0, err
+	}
+	block, found, err := findInitialized(ctx, lending, from, head)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("no Initialized event since the deploy block %d", from)
+	}
+	return block, nil
+}
+
+// realizedAPY annualizes the growth of the deposit index between two samples.
+func realizedAPY(from, to *indexSample) float64 {
+	if to.Time <= from.Time || from.Index.Sign() == 0 {
+		return 0
+	}
+	growth, _ := new(big.Float).Quo(to.Index, from.Index).Float64()
+	years := float64(to.Time-from.Time) / secondsPerYear
+	return math.Pow(growth, 1/years) - 1
+}
+
+// runAPY implements the apy subcommand, treating head as the current block.
+func runAPY(client *ethclient.Client, lending *defi.Defi, head *types.Header, args []string) {
+	apyCmd := flag.NewFlagSet("apy", flag.ExitOnError)
+	sourceFlag := apyCmd.String("source", "archive", "Where to read historical index values: 'archive' (DepositIndex at past blocks) or 'events' (Deposited/Withdrawn ratios)")
+	inceptionFlag := apyCmd.Uint64("inception-block", 0, "Block the market was deployed at (default: block of the first Initialized event)")
+	rangeFlag := apyCmd.Duration("range", 30*24*time.Hour, "Time span covered by the chart or CSV series")
+	samplesFlag := apyCmd.Int("samples", 30, "Number of points in the series")
+	csvFlag := apyCmd.Bool("csv", false, "Print the series as CSV instead of a sparkline")
+	apyCmd.Parse(args)
+
+	if *sourceFlag != "archive" && *sourceFlag != "events" {
+		log.Fatal("--source must be 'archive' or 'events'")
+	}
+	if *samplesFlag < 2 {
+		log.Fatal("--samples must be at least 2")
+	}
+	ctx := context.Background()
+	var err error
+
+	inception := *inceptionFlag
+	if inception == 0 {
+		if inception, err = inceptionBlock(ctx, client, lending, head.Number.Uint64()); err != nil {
+			log.Fatal("Failed to find the Initialized event, pass --inception-block:", err)
+		}
+	}
+	inceptionHeader, err := headerAt(ctx, client, inception)
+	if err != nil {
+		log.Fatal("Failed to get inception block:", err)
+	}
+
+	var source indexSource = &archiveIndexSource{lending: lending}
+	if *sourceFlag == "events" {
+		if source, err = newEventIndexSource(ctx, client, lending, inception, head.Number.Uint64()); err != nil {
+			log.Fatal("Failed to index deposit events:", err)
+		}
+	}
+	current, err := (&archiveIndexSource{lending: lending}).IndexAt(ctx, head)
+	if err != nil {
+		log.Fatal("Failed to read current deposit index:", err)
+	}
+
+	// sampleAt resolves a timestamp to a block and reads the index there.
+	sampleAt := func(ts uint64) (*indexSample, error) {
+		if ts <= inceptionHeader.Time {
+			return source.IndexAt(ctx, inceptionHeader)
+		}
+		header, err := blockAtTime(ctx, client, ts)
+		if err != nil {
+			return nil, err
+		}
+		return source.IndexAt(ctx, header)
+	}
+
+	if !*csvFlag {
+		fmt.Printf("Share price: %s at block %s\n", new(big.Float).Quo(current.Index, indexScale).Text('f', 6), head.Number)
+		windows := []struct {
+			label string
+			span  time.Duration
+		}{{"1d", 24 * time.Hour}, {"7d", 7 * 24 * time.Hour}, {"30d", 30 * 24 * time.Hour}}
+		for _, w := range windows {
+			past, err := sampleAt(head.Time - uint64(w.span.Seconds()))
+			if err != nil {
+				fmt.Printf("%-16s n/a (%v)\n", w.label+" APY:", err)
+				continue
+			}
+			fmt.Printf("%-16s %.4f%%\n", w.label+" APY:", realizedAPY(past, current)*100)
+		}
+		if first, err := source.IndexAt(ctx, inceptionHeader); err == nil {
+			fmt.Printf("%-16s %.4f%% (since block %d)\n", "Inception APY:", realizedAPY(first, current)*100, inception)
+		} else {
+			fmt.Printf("%-16s n/a (%v)\n", "Inception APY:", err)
+		}
+	}
+
+	// Build the series of index samples evenly spaced over the range.
+	step := uint64(rangeFlag.Seconds()) / uint64(*samplesFlag-1)
+	start := head.Time - uint64(rangeFlag.Seconds())
+	var series []*indexSample
+	for i := 0; i < *samplesFlag-1; i++ {
+		sample, err := sampleAt(start + uint64(i)*step)
+		if err != nil {
+			continue
+		}
+		series = append(series, sample)
+	}
+	series = append(series, current)
+
+	if *csvFlag {
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"time", "block", "share_price", "apy"})
+		for i, s := range series {
+			apy := ""
+			if i > 0 {
+				apy = strconv.FormatFloat(realizedAPY(series[i-1], s), 'f', 6, 64)
+			}
+			w.Write([]string{
+				time.Unix(int64(s.Time), 0).UTC().Format(time.RFC3339),
+				strconv.FormatUint(s.Block, 10),
+				new(big.Float).Quo(s.Index, indexScale).Text('f', 8),
+				apy,
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			log.Fatal("Failed to write CSV:", err)
+		}
+		return
+	}
+
+	var apys []float64
+	for i := 1; i < len(series); i++ {
+		apys = append(apys, realizedAPY(series[i-1], series[i]))
+	}
+	if len(apys) > 0 {
+		fmt.Printf("APY over the last %s: %s\n", rangeFlag.String(), sparkline(apys))
+	}
+}
+
+// sparkline renders values as a line of block characters scaled between their min and max.
+func sparkline(values []float64) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if hi > lo {
+			i = int((v - lo) / (hi - lo) * float64(len(bars)-1))
+		}
+		b.WriteRune(bars[i])
+	}
+	return fmt.Sprintf("%s (min %.2f%%, max %.2f%%)", b.String(), lo*100, hi*100)
+}
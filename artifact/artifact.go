@@ -0,0 +1,116 @@
+// Package artifact loads compiled contracts from Foundry and Hardhat JSON artifacts.
+package artifact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Artifact is a compiled contract loaded from a Foundry or Hardhat JSON artifact.
+type Artifact struct {
+	Name     string
+	Path     string
+	ABI      abi.ABI
+	RawABI   json.RawMessage // the ABI exactly as written by the compiler
+	Bytecode []byte
+}
+
+// artifactBytecode accepts both Foundry ({"object": "0x..."}) and Hardhat ("0x...") bytecode fields.
+type artifactBytecode string
+
+func (b *artifactBytecode) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var foundry struct {
+			Object string `json:"object"`
+		}
+		if err := json.Unmarshal(data, &foundry); err != nil {
+			return err
+		}
+		*b = artifactBytecode(foundry.Object)
+		return nil
+	}
+	return json.Unmarshal(data, (*string)(b))
+}
+
+// decode converts the hex bytecode, rejecting bytecode with unlinked library placeholders.
+func (b artifactBytecode) decode() ([]byte, error) {
+	s := string(b)
+	if s == "" {
+		return nil, nil
+	}
+	if strings.Contains(s, "__") {
+		return nil, fmt.Errorf("bytecode has unlinked library references")
+	}
+	if !strings.HasPrefix(s, "0x") {
+		s = "0x" + s
+	}
+	return hexutil.Decode(s)
+}
+
+// Find searches dir for the artifact of a contract: out/<File>.sol/<Contract>.json with Foundry,
+// artifacts/contracts/<File>.sol/<Contract>.json with Hardhat. Debug and build-info files are skipped.
+func Find(dir, contract string) (string, error) {
+	var matches []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == "build-info" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && d.Name() == contract+".json" {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no artifact for %s under %s", contract, dir)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("several artifacts for %s under %s: %s", contract, dir, strings.Join(matches, ", "))
+}
+
+// Load finds and parses the artifact of a contract.
+func Load(dir, contract string) (*Artifact, error) {
+	path, err := Find(dir, contract)
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(path)
+}
+
+// LoadFile parses an artifact file; the contract name is taken from the file name.
+func LoadFile(path string) (*Artifact, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		ABI      json.RawMessage  `json:"abi"`
+		Bytecode artifactBytecode `json:"bytecode"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	a := &Artifact{Name: strings.TrimSuffix(filepath.Base(path), ".json"), Path: path, RawABI: raw.ABI}
+	if a.ABI, err = abi.JSON(bytes.NewReader(raw.ABI)); err != nil {
+		return nil, fmt.Errorf("%s: invalid ABI: %w", path, err)
+	}
+	if a.Bytecode, err = raw.Bytecode.decode(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return a, nil
+}
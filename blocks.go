@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// blockAtTime returns the header of the last block mined at or before a unix timestamp,
+// found by binary search over block timestamps.
+func blockAtTime(ctx context.Context, client *ethclient.Client, timestamp uint64) (*types.Header, error) {
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if head.Time <= timestamp {
+		return head, nil
+	}
+	lo, hi := uint64(0), head.Number.Uint64()
+	genesis, err := headerAt(ctx, client, lo)
+	if err != nil {
+		return nil, err
+	}
+	if genesis.Time > timestamp {
+		return nil, fmt.Errorf("timestamp %d is before the genesis block", timestamp)
+	}
+	// Invariant: block lo is at or before the timestamp, block hi is after it.
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		h, err := headerAt(ctx, client, mid)
+		if err != nil {
+			return nil, err
+		}
+		if h.Time <= timestamp {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return headerAt(ctx, client, lo)
+}
+
+// headerAt fetches the header of a block number.
+func headerAt(ctx context.Context, client *ethclient.Client, number uint64) (*types.Header, error) {
+	return client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+}
+
+// resolveReadBlock resolves the --block and --at global flags to the header reads should be pinned to.
+// block accepts a number, a 0x-prefixed hash, "latest", "safe" or "finalized"; at accepts RFC 3339 or unix seconds
+// and takes precedence when set.
+func resolveReadBlock(ctx context.Context, client *ethclient.Client, block, at string) (*types.Header, error) {
+	if at != "" {
+		ts, err := parseTimestamp(at)
+		if err != nil {
+			return nil, err
+		}
+		return blockAtTime(ctx, client, ts)
+	}
+	switch block {
+	case "", "latest":
+		return client.HeaderByNumber(ctx, nil)
+	case "safe":
+		return client.HeaderByNumber(ctx, big.NewInt(int64(rpc.SafeBlockNumber)))
+	case "finalized":
+		return client.HeaderByNumber(ctx, big.NewInt(int64(rpc.FinalizedBlockNumber)))
+	}
+	if strings.HasPrefix(block, "0x") && len(block) == 2+2*common.HashLength {
+		return client.HeaderByHash(ctx, common.HexToHash(block))
+	}
+	number, err := strconv.ParseUint(block, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block %q: expected a number, hash, 'latest', 'safe' or 'finalized'", block)
+	}
+	return headerAt(ctx, client, number)
+}
+
+// parseTimestamp parses an RFC 3339 time or unix seconds.
+func parseTimestamp(s string) (uint64, error) {
+	if ts, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return ts, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: expected RFC 3339 or unix seconds", s)
+	}
+	if t.Unix() < 0 {
+		return 0, fmt.Errorf("time %q is before the unix epoch", s)
+	}
+	return uint64(t.Unix()), nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"1700000000", 1700000000, false},
+		{"2024-01-01T00:00:00Z", 1704067200, false},
+		{"2024-01-01T02:00:00+02:00", 1704067200, false},
+		{"1970-01-01T00:00:00Z", 0, false},
+		{"1969-12-31T23:59:59Z", 0, true},
+		{"2024-01-01", 0, true},
+		{"-5", 0, true},
+		{"yesterday", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimestamp(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTimestamp(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parseTimestamp(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
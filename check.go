@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"defi-lending/artifact"
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// abiEntries describes every function, event and error of an ABI as a comparable string.
+func abiEntries(parsed *abi.ABI) map[string]bool {
+	entries := map[string]bool{}
+	for _, m := range parsed.Methods {
+		outputs := make([]string, len(m.Outputs))
+		for i, o := range m.Outputs {
+			outputs[i] = o.Type.String()
+		}
+		entries[fmt.Sprintf("function %s %s returns (%s)", m.Sig, m.StateMutability, strings.Join(outputs, ","))] = true
+	}
+	for _, e := range parsed.Events {
+		inputs := make([]string, len(e.Inputs))
+		for i, in := range e.Inputs {
+			inputs[i] = in.Type.String()
+			if in.Indexed {
+				inputs[i] += " indexed"
+			}
+		}
+		entries[fmt.Sprintf("event %s(%s)", e.RawName, strings.Join(inputs, ","))] = true
+	}
+	for _, e := range parsed.Errors {
+		entries["error "+e.Sig] = true
+	}
+	return entries
+}
+
+// diffABI lists entries only in the binding ("-") or only in the artifact ("+").
+func diffABI(binding, compiled *abi.ABI) []string {
+	have, want := abiEntries(binding), abiEntries(compiled)
+	var diff []string
+	for e := range have {
+		if !want[e] {
+			diff = append(diff, "- "+e)
+		}
+	}
+	for e := range want {
+		if !have[e] {
+			diff = append(diff, "+ "+e)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i][2:] < diff[j][2:] })
+	return diff
+}
+
+// EVM opcodes bounding the PUSH1-PUSH32 range.
+const (
+	opPush1  = 0x60
+	opPush32 = 0x7f
+)
+
+// pushedSelectors returns the operands of every PUSH1-PUSH4 in runtime code, which is how solc's
+// dispatcher compares function selectors (selectors with leading zero bytes use a shorter push).
+// Push data is skipped so it is not read as opcodes.
+func pushedSelectors(code []byte) map[uint32]bool {
+	found := map[uint32]bool{}
+	for pc := 0; pc < len(code); pc++ {
+		op := code[pc]
+		if op < opPush1 || op > opPush32 {
+			continue
+		}
+		size := int(op-opPush1) + 1
+		if size <= 4 && pc+size < len(code) {
+			var word [4]byte
+			copy(word[4-size:], code[pc+1:pc+1+size])
+			found[binary.BigEndian.Uint32(word[:])] = true
+		}
+		pc += size
+	}
+	return found
+}
+
+// missingSelectors lists the binding's functions whose selector does not appear in runtime code.
+func missingSelectors(binding *abi.ABI, code []byte) []string {
+	present := pushedSelectors(code)
+	var missing []string
+	for _, m := range binding.Methods {
+		if !present[binary.BigEndian.Uint32(m.ID)] {
+			missing = append(missing, fmt.Sprintf("%s (0x%x)", m.Sig, m.ID))
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// runCheck implements the check subcommand group.
+func runCheck(client *ethclient.Client, head *types.Header, args []string) {
+	if len(args) == 0 || args[0] != "bindings" {
+		fmt.Println("Usage: check bindings [--artifacts contracts/out]")
+		os.Exit(1)
+	}
+	checkCmd := flag.NewFlagSet("check bindings", flag.ExitOnError)
+	artifactsFlag := checkCmd.String("artifacts", envOr("ARTIFACTS_DIR", defaultArtifactsDir), "Directory with the compiled artifacts (default $ARTIFACTS_DIR or "+defaultArtifactsDir+"); empty skips the artifact diff")
+	lendingFlag := checkCmd.String("lending-contract", "DeFiLending", "Contract name of the lending artifact")
+	tokenFlag := checkCmd.String("token-contract", "uSDC", "Contract name of the token artifact")
+	checkCmd.Parse(args[1:])
+
+	ctx := context.Background()
+	// The proxy's own code only delegates, so lending selectors are looked up in the implementation.
+	proxy := common.HexToAddress(contractAddress)
+	impl, err := readAddressSlot(ctx, client, proxy, erc1967ImplementationSlot, head.Number)
+	if err != nil {
+		log.Fatal("Failed to read implementation slot:", err)
+	}
+	if impl == (common.Address{}) {
+		impl = proxy
+	}
+	bindings := []struct {
+		name     string
+		meta     *bind.MetaData
+		contract string
+		address  common.Address
+	}{
+		{"defi", defi.DefiMetaData, *lendingFlag, impl},
+		{"usdc", usdc.UsdcMetaData, *tokenFlag, common.HexToAddress(usdcContractAddress)},
+	}
+
+	failed := false
+	report := func(title string, lines []string) {
+		if len(lines) == 0 {
+			fmt.Printf("[OK  ] %s\n", title)
+			return
+		}
+		failed = true
+		fmt.Printf("[FAIL] %s\n", title)
+		for _, l := range lines {
+			fmt.Println("       ", l)
+		}
+	}
+	for _, b := range bindings {
+		parsed, err := b.meta.GetAbi()
+		if err != nil {
+			log.Fatalf("Failed to parse %s binding ABI: %v", b.name, err)
+		}
+		if *artifactsFlag != "" {
+			a, err := artifact.Load(*artifactsFlag, b.contract)
+			if err != nil {
+				log.Fatal("Failed to load artifact:", err)
+			}
+			report(fmt.Sprintf("%s binding ABI matches %s", b.name, a.Path), diffABI(parsed, &a.ABI))
+		}
+		code, err := client.CodeAt(ctx, b.address, head.Number)
+		if err != nil {
+			log.Fatalf("Failed to get code of %s: %v", b.address.Hex(), err)
+		}
+		if len(code) == 0 {
+			report(fmt.Sprintf("%s binding functions are deployed at %s", b.name, b.address.Hex()), []string{"no contract code"})
+			continue
+		}
+		report(fmt.Sprintf("%s binding functions are deployed at %s", b.name, b.address.Hex()), missingSelectors(parsed, code))
+	}
+	if failed {
+		fmt.Println("\nRegenerate the bindings with 'go generate ./...' after rebuilding the contracts.")
+		os.Exit(2)
+	}
+}
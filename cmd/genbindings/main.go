@@ -0,0 +1,82 @@
+// Command genbindings regenerates an abigen binding, bytecode included, from a Foundry or Hardhat artifact.
+// It is run by the go:generate directives in the defi and usdc packages.
+//
+// The artifacts directory, from -artifacts or $ARTIFACTS_DIR, is resolved against the module root like the
+// deploy and check commands do, not against the package being generated. When it does not exist, for example
+// on a checkout where the contracts have not been built, the committed binding is left unchanged.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"defi-lending/artifact"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func main() {
+	artifactsFlag := flag.String("artifacts", "contracts/out", "Directory with the compiled artifacts, relative to the module root")
+	contractFlag := flag.String("contract", "", "Contract name of the artifact")
+	pkgFlag := flag.String("pkg", "", "Go package of the binding")
+	typeFlag := flag.String("type", "", "Go type name of the binding")
+	outFlag := flag.String("out", "", "Output file")
+	flag.Parse()
+
+	if *contractFlag == "" || *pkgFlag == "" || *typeFlag == "" || *outFlag == "" {
+		log.Fatal("Usage: genbindings -contract <name> -pkg <package> -type <type> -out <file> [-artifacts <dir>]")
+	}
+	if dir := os.Getenv("ARTIFACTS_DIR"); dir != "" {
+		*artifactsFlag = dir
+	}
+	dir, err := resolveArtifactsDir(*artifactsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		log.Printf("Skipping %s: no artifacts at %s (run forge build --root contracts first); the committed binding is unchanged", *outFlag, dir)
+		return
+	}
+	a, err := artifact.Load(dir, *contractFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var bytecode string
+	if len(a.Bytecode) > 0 {
+		bytecode = hexutil.Encode(a.Bytecode)
+	}
+	code, err := bind.Bind([]string{*typeFlag}, []string{string(a.RawABI)}, []string{bytecode}, []map[string]string{nil}, *pkgFlag, bind.LangGo, nil, nil)
+	if err != nil {
+		log.Fatalf("Failed to generate binding for %s: %v", a.Path, err)
+	}
+	if err := os.WriteFile(*outFlag, []byte(code), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Generated %s from %s", *outFlag, a.Path)
+}
+
+// resolveArtifactsDir makes a relative artifacts directory relative to the root of the enclosing module.
+func resolveArtifactsDir(dir string) (string, error) {
+	if filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(root, "go.mod")); err == nil {
+			return filepath.Join(root, dir), nil
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			return "", fmt.Errorf("no go.mod above the working directory to resolve %s against", dir)
+		}
+		root = parent
+	}
+}
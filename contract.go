@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"defi-lending/artifact"
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// knownContract is a contract whose ABI the CLI ships with.
+type knownContract struct {
+	Name    string
+	Address common.Address
+	ABI     *abi.ABI
+}
+
+// knownContracts returns the lending and uSDC contracts with their binding ABIs.
+func knownContracts() ([]knownContract, error) {
+	lendingABI, err := defi.DefiMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	usdcABI, err := usdc.UsdcMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return []knownContract{
+		{"lending", common.HexToAddress(contractAddress), lendingABI},
+		{"usdc", common.HexToAddress(usdcContractAddress), usdcABI},
+	}, nil
+}
+
+// loadABIFile reads a plain JSON ABI or a Foundry/Hardhat artifact.
+func loadABIFile(path string) (*abi.ABI, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		parsed, err := abi.JSON(strings.NewReader(string(data)))
+		return &parsed, err
+	}
+	a, err := artifact.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &a.ABI, nil
+}
+
+// resolveContract resolves --contract ("lending", "usdc" or an address) and --abi to an address and ABI.
+func resolveContract(target, abiPath string) (common.Address, *abi.ABI, error) {
+	known, err := knownContracts()
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	var addr common.Address
+	var parsed *abi.ABI
+	for _, k := range known {
+		if strings.EqualFold(target, k.Name) || (common.IsHexAddress(target) && common.HexToAddress(target) == k.Address) {
+			addr, parsed = k.Address, k.ABI
+		}
+	}
+	if parsed == nil {
+		if !common.IsHexAddress(target) {
+			return common.Address{}, nil, fmt.Errorf("unknown contract %q: use lending, usdc or an address", target)
+		}
+		addr = common.HexToAddress(target)
+	}
+	if abiPath != "" {
+		if parsed, err = loadABIFile(abiPath); err != nil {
+			return common.Address{}, nil, fmt.Errorf("load ABI %s: %w", abiPath, err)
+		}
+	}
+	if parsed == nil {
+		return common.Address{}, nil, fmt.Errorf("no ABI for %s: pass --abi", addr.Hex())
+	}
+	return addr, parsed, nil
+}
+
+// lookupMethod finds a method by name, or by full signature such as "transfer(address,uint256)" for overloads.
+func lookupMethod(parsed *abi.ABI, name string) (abi.Method, error) {
+	name = strings.ReplaceAll(name, " ", "")
+	var matches []abi.Method
+	for _, m := range parsed.Methods {
+		if m.Sig == name || (!strings.Contains(name, "(") && m.RawName == name) {
+			matches = append(matches, m)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return abi.Method{}, fmt.Errorf("no method %q in the ABI", name)
+	case 1:
+		return matches[0], nil
+	}
+	sigs := make([]string, len(matches))
+	for i, m := range matches {
+		sigs[i] = m.Sig
+	}
+	sort.Strings(sigs)
+	return abi.Method{}, fmt.Errorf("%q is overloaded, use one of: %s", name, strings.Join(sigs, ", "))
+}
+
+// packMethodCall parses the command-line arguments of a method and encodes the calldata.
+func packMethodCall(method abi.Method, values []string) ([]byte, error) {
+	packed, err := packArguments(method.Inputs, values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", method.Sig, err)
+	}
+	return append(append([]byte{}, method.ID...), packed...), nil
+}
+
+// printValues prints decoded arguments or return values one per line.
+func printValues(args abi.Arguments, values []interface{}) {
+	for i, v := range values {
+		name := args[i].Name
+		if name == "" {
+			name = fmt.Sprintf("[%d]", i)
+		}
+		fmt.Printf("  %s (%s): %s\n", name, args[i].Type.String(), formatABIValue(v))
+	}
+}
+
+// printReceiptLogs decodes every log of a receipt against the known ABIs plus an extra one.
+func printReceiptLogs(receipt *types.Receipt, extra *abi.ABI) {
+	known, err := knownContracts()
+	if err != nil {
+		log.Fatal("Failed to load ABIs:", err)
+	}
+	abis := []*abi.ABI{extra}
+	for _, k := range known {
+		abis = append(abis, k.ABI)
+	}
+	for _, l := range receipt.Logs {
+		var evt *decodedEvent
+		for _, parsed := range abis {
+			if parsed == nil {
+				continue
+			}
+			if evt, err = decodeEvent(parsed, *l); err == nil {
+				break
+			}
+		}
+		if evt == nil {
+			fmt.Printf("  log %d from %s: undecoded, topics %v\n", l.Index, l.Address.Hex(), l.Topics)
+			continue
+		}
+		fmt.Printf("  log %d %s from %s\n", l.Index, evt.Name, l.Address.Hex())
+		names := make([]string, 0, len(evt.Fields))
+		for name := range evt.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("    %s: %s\n", name, formatABIValue(evt.Fields[name]))
+		}
+	}
+}
+
+// contractFlags registers the flags shared by call and send.
+func contractFlags(fs *flag.FlagSet) (target, abiPath *string) {
+	target = fs.String("contract", "lending", "Contract to use: lending, usdc or an address")
+	abiPath = fs.String("abi", "", "JSON ABI or Foundry/Hardhat artifact to use instead of the built-in bindings")
+	return target, abiPath
+}
+
+// runCall implements the call subcommand: an eth_call of any ABI method with decoded return values.
+func runCall(client *ethclient.Client, head *types.Header, args []string) {
+	callCmd := flag.NewFlagSet("call", flag.ExitOnError)
+	target, abiPath := contractFlags(callCmd)
+	fromFlag := callCmd.String("from", "", "Address to call from (for methods that depend on msg.sender)")
+	callCmd.Parse(args)
+
+	if callCmd.NArg() < 1 {
+		fmt.Println("Usage: call [--contract lending|usdc|<address>] [--abi <file>] [--from <address>] <method> [args...]")
+		os.Exit(1)
+	}
+	addr, parsed, err := resolveContract(*target, *abiPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	method, err := lookupMethod(parsed, callCmd.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := packMethodCall(method, callCmd.Args()[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	msg := ethereum.CallMsg{To: &addr, Data: data}
+	if *fromFlag != "" {
+		if !common.IsHexAddress(*fromFlag) {
+			log.Fatalf("Invalid --from address %q", *fromFlag)
+		}
+		msg.From = common.HexToAddress(*fromFlag)
+	}
+	out, err := client.CallContract(context.Background(), msg, head.Number)
+	if err != nil {
+		log.Fatal("Call failed:", err)
+	}
+	values, err := method.Outputs.Unpack(out)
+	if err != nil {
+		log.Fatalf("Failed to decode return data 0x%x: %v", out, err)
+	}
+	fmt.Printf("%s on %s at block %s:\n", method.Sig, addr.Hex(), head.Number)
+	printValues(method.Outputs, values)
+}
+
+// runSend implements the send subcommand: a transaction to any ABI method, with its events decoded.
+func runSend(client *ethclient.Client, args []string) {
+	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	target, abiPath := contractFlags(sendCmd)
+	privateKeyFlag := sendCmd.String("private-key", "", "Private key for signing the transaction")
+	valueFlag := sendCmd.String("value", "0", "ETH to send with payable methods (wei, or with a unit such as 0.1ether)")
+	sendCmd.BoolVar(&assumeYes, "yes", false, "Skip the confirmation prompt")
+	var gas gasPolicy
+	gas.register(sendCmd)
+	sendCmd.Parse(args)
+
+	if sendCmd.NArg() < 1 || *privateKeyFlag == "" {
+		fmt.Println("Usage: send [--contract lending|usdc|<address>] [--abi <file>] --private-key <private-key> [--value 0] [--yes] <method> [args...]")
+		os.Exit(1)
+	}
+	addr, parsed, err := resolveContract(*target, *abiPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	method, err := lookupMethod(parsed, sendCmd.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if method.IsConstant() {
+		log.Fatalf("%s is a %s method; use call instead", method.Sig, method.StateMutability)
+	}
+	data, err := packMethodCall(method, sendCmd.Args()[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	value, err := parseInteger(*valueFlag)
+	if err != nil || value.Sign() < 0 {
+		log.Fatalf("Invalid --value %q", *valueFlag)
+	}
+	if value.Sign() > 0 && !method.Payable {
+		log.Fatalf("%s is not payable", method.Sig)
+	}
+
+	ctx := context.Background()
+	auth, err := newTransactor(client, *privateKeyFlag)
+	if err != nil {
+		log.Fatal("Failed to create transactor:", err)
+	}
+	gas.apply(auth)
+	auth.Value = value
+	auth.Context = ctx
+	if _, err := client.CallContract(ctx, ethereum.CallMsg{From: auth.From, To: &addr, Value: value, Data: data}, nil); err != nil {
+		log.Fatal("Simulation reverted:", err)
+	}
+
+	contract := bind.NewBoundContract(addr, *parsed, client, client, client)
+	tx, err := contract.RawTransact(auth, data)
+	if err != nil {
+		log.Fatal("Failed to send transaction:", err)
+	}
+	fmt.Printf("%s transaction sent, tx hash: %s\n", method.Sig, tx.Hash().Hex())
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		log.Fatal("Failed to wait for transaction:", err)
+	}
+	status := "success"
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		status = "reverted"
+	}
+	fmt.Printf("Mined in block %s: %s, gas used %d\n", receipt.BlockNumber, status, receipt.GasUsed)
+	printReceiptLogs(receipt, parsed)
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// tokenAmountArgs names the arguments of the lending and uSDC ABIs that hold uSDC amounts.
+var tokenAmountArgs = map[string]bool{
+	"amount":             true,
+	"value":              true,
+	"initialSupply":      true,
+	"newPrincipal":       true,
+	"remainingPrincipal": true,
+	"collateralSeized":   true,
+}
+
+// panicReasons describes the codes of Solidity's Panic(uint256) error.
+var panicReasons = map[uint64]string{
+	0x01: "assertion failed",
+	0x11: "arithmetic overflow or underflow",
+	0x12: "division or modulo by zero",
+	0x21: "invalid enum value",
+	0x22: "invalid storage byte array",
+	0x31: "pop on empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to an uninitialized function pointer",
+}
+
+// formatArgument renders a decoded argument, adding whole tokens for uSDC amounts.
+func formatArgument(arg abi.Argument, v interface{}) string {
+	s := formatABIValue(v)
+	if n, ok := v.(*big.Int); ok && tokenAmountArgs[arg.Name] {
+		s += " (" + formatToken(n) + " uSDC)"
+	}
+	return s
+}
+
+// decodeCalldata identifies the lending or uSDC function called by calldata and decodes its arguments.
+// The ABI of the contract at to, when known, is tried first.
+func decodeCalldata(data []byte, to *common.Address) (string, *abi.Method, []interface{}, error) {
+	if len(data) < 4 {
+		return "", nil, nil, fmt.Errorf("calldata is %d bytes, shorter than a selector", len(data))
+	}
+	known, err := knownContracts()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if to != nil {
+		for i, k := range known {
+			if k.Address == *to {
+				known[0], known[i] = known[i], known[0]
+			}
+		}
+	}
+	for _, k := range known {
+		method, err := k.ABI.MethodById(data[:4])
+		if err != nil {
+			continue
+		}
+		values, err := method.Inputs.Unpack(data[4:])
+		if err != nil {
+			return k.Name, method, nil, fmt.Errorf("decode %s arguments: %w", method.Sig, err)
+		}
+		return k.Name, method, values, nil
+	}
+	return "", nil, nil, fmt.Errorf("unknown selector 0x%x", data[:4])
+}
+
+// printCalldata prints decoded calldata, recursing into the initializer of upgradeToAndCall.
+func printCalldata(data []byte, to *common.Address, indent string) {
+	contract, method, values, err := decodeCalldata(data, to)
+	if err != nil {
+		fmt.Printf("%sCalldata: %v\n", indent, err)
+		return
+	}
+	fmt.Printf("%sFunction: %s.%s (selector 0x%x)\n", indent, contract, method.Sig, method.ID)
+	for i, v := range values {
+		arg := method.Inputs[i]
+		fmt.Printf("%s  %s (%s): %s\n", indent, arg.Name, arg.Type.String(), formatArgument(arg, v))
+		if method.RawName == "upgradeToAndCall" && arg.Name == "data" {
+			if inner := v.([]byte); len(inner) > 0 {
+				printCalldata(inner, to, indent+"    ")
+			}
+		}
+	}
+}
+
+// describeLog renders a log with the typed Parse helpers of the bindings, falling back to generic decoding.
+func describeLog(lending *defi.Defi, usdcToken *usdc.Usdc, l types.Log) string {
+	lendingAddr, usdcAddr := common.HexToAddress(contractAddress), common.HexToAddress(usdcContractAddress)
+	if l.Address == lendingAddr {
+		if e, err := lending.ParseDeposited(l); err == nil {
+			return fmt.Sprintf("Deposited: user %s, amount %s, shares %s", e.User.Hex(), formatToken(e.Amount), e.Shares)
+		}
+		if e, err := lending.ParseWithdrawn(l); err == nil {
+			return fmt.Sprintf("Withdrawn: user %s, amount %s, shares %s", e.User.Hex(), formatToken(e.Amount), e.Shares)
+		}
+		if e, err := lending.ParseBorrowed(l); err == nil {
+			return fmt.Sprintf("Borrowed: user %s, amount %s, new principal %s", e.User.Hex(), formatToken(e.Amount), formatToken(e.NewPrincipal))
+		}
+		if e, err := lending.ParseRepaid(l); err == nil {
+			return fmt.Sprintf("Repaid: user %s, amount %s, remaining principal %s", e.User.Hex(), formatToken(e.Amount), formatToken(e.RemainingPrincipal))
+		}
+		if e, err := lending.ParseLiquidated(l); err == nil {
+			return fmt.Sprintf("Liquidated: user %s, collateral seized %s", e.User.Hex(), formatToken(e.CollateralSeized))
+		}
+		if e, err := lending.ParseUpgraded(l); err == nil {
+			return fmt.Sprintf("Upgraded: implementation %s", e.Implementation.Hex())
+		}
+		if e, err := lending.ParseInitialized(l); err == nil {
+			return fmt.Sprintf("Initialized: version %d", e.Version)
+		}
+		if e, err := lending.ParseOwnershipTransferred(l); err == nil {
+			return fmt.Sprintf("OwnershipTransferred: %s -> %s", e.PreviousOwner.Hex(), e.NewOwner.Hex())
+		}
+	}
+	if l.Address == usdcAddr {
+		if e, err := usdcToken.ParseTransfer(l); err == nil {
+			return fmt.Sprintf("Transfer: %s -> %s, value %s", e.From.Hex(), e.To.Hex(), formatToken(e.Value))
+		}
+		if e, err := usdcToken.ParseApproval(l); err == nil {
+			return fmt.Sprintf("Approval: owner %s, spender %s, value %s", e.Owner.Hex(), e.Spender.Hex(), formatToken(e.Value))
+		}
+	}
+	known, err := knownContracts()
+	if err == nil {
+		for _, k := range known {
+			if evt, err := decodeEvent(k.ABI, l); err == nil {
+				fields := make([]string, 0, len(evt.Fields))
+				for name, v := range evt.Fields {
+					fields = append(fields, name+" "+formatArgument(abi.Argument{Name: name}, v))
+				}
+				sort.Strings(fields)
+				return fmt.Sprintf("%s (%s ABI, emitted by %s): %s", evt.Name, k.Name, l.Address.Hex(), strings.Join(fields, ", "))
+			}
+		}
+	}
+	return fmt.Sprintf("unknown event from %s, topics %v, data 0x%x", l.Address.Hex(), l.Topics, l.Data)
+}
+
+// revertData extracts the revert payload carried by an eth_call error.
+func revertData(err error) ([]byte, bool) {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return nil, false
+	}
+	s, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return nil, false
+	}
+	data, decodeErr := hexutil.Decode(s)
+	return data, decodeErr == nil
+}
+
+// decodeRevert explains revert data: Error(string), Panic(uint256) or a custom error of the known ABIs.
+func decodeRevert(data []byte) string {
+	if len(data) == 0 {
+		return "reverted without data"
+	}
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return fmt.Sprintf("Error(%q)", reason)
+	}
+	if len(data) == 36 && bytes.Equal(data[:4], []byte{0x4e, 0x48, 0x7b, 0x71}) {
+		code := new(big.Int).SetBytes(data[4:])
+		reason := panicReasons[code.Uint64()]
+		if reason == "" {
+			reason = "unknown panic code"
+		}
+		return fmt.Sprintf("Panic(0x%x): %s", code, reason)
+	}
+	known, err := knownContracts()
+	if err == nil && len(data) >= 4 {
+		for _, k := range known {
+			for _, e := range k.ABI.Errors {
+				if !bytes.Equal(e.ID[:4], data[:4]) {
+					continue
+				}
+				values, err := e.Inputs.Unpack(data[4:])
+				if err != nil {
+					continue
+				}
+				args := make([]string, len(values))
+				for i, v := range values {
+					args[i] = e.Inputs[i].Name + ": " + formatArgument(e.Inputs[i], v)
+				}
+				return fmt.Sprintf("%s(%s) [%s]", e.Name, strings.Join(args, ", "), k.Name)
+			}
+		}
+	}
+	return fmt.Sprintf("unknown revert data 0x%x", data)
+}
+
+// runDecode implements the decode subcommand group.
+func runDecode(client *ethclient.Client, lending *defi.Defi, usdcToken *usdc.Usdc, args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: decode <tx <hash>|calldata <hex>|revert <hex>>")
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "tx":
+		decodeTx(client, lending, usdcToken, args[1])
+	case "calldata":
+		data, err := hexutil.Decode(args[1])
+		if err != nil {
+			log.Fatal("Invalid calldata:", err)
+		}
+		printCalldata(data, nil, "")
+	case "revert":
+		data, err := hexutil.Decode(args[1])
+		if err != nil {
+			log.Fatal("Invalid revert data:", err)
+		}
+		fmt.Println(decodeRevert(data))
+	default:
+		fmt.Println("Usage: decode <tx <hash>|calldata <hex>|revert <hex>>")
+		os.Exit(1)
+	}
+}
+
+// decodeTx prints a transaction's call, every log of its receipt and, if it failed, the revert reason.
+func decodeTx(client *ethclient.Client, lending *defi.Defi, usdcToken *usdc.Usdc, hashHex string) {
+	if len(hashHex) != 66 {
+		log.Fatalf("Invalid transaction hash %q", hashHex)
+	}
+	ctx := context.Background()
+	hash := common.HexToHash(hashHex)
+	tx, pending, err := client.TransactionByHash(ctx, hash)
+	if err != nil {
+		log.Fatal("Failed to get transaction:", err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		log.Fatal("Failed to recover sender:", err)
+	}
+	fmt.Println("Transaction:", hash.Hex())
+	fmt.Println("From:       ", from.Hex())
+	if tx.To() != nil {
+		fmt.Println("To:         ", tx.To().Hex())
+	} else {
+		fmt.Println("To:          (contract creation)")
+	}
+	if tx.Value().Sign() > 0 {
+		fmt.Println("Value:      ", formatUnits(tx.Value(), 18), "ETH")
+	}
+	if tx.To() != nil {
+		printCalldata(tx.Data(), tx.To(), "")
+	}
+	if pending {
+		fmt.Println("Status:      pending")
+		return
+	}
+
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if err != nil {
+		log.Fatal("Failed to get receipt:", err)
+	}
+	status := "success"
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		status = "reverted"
+	}
+	fmt.Printf("Status:      %s in block %s, gas used %d\n", status, receipt.BlockNumber, receipt.GasUsed)
+	if receipt.ContractAddress != (common.Address{}) {
+		fmt.Println("Created:    ", receipt.ContractAddress.Hex())
+	}
+	if len(receipt.Logs) > 0 {
+		fmt.Printf("\nLogs (%d):\n", len(receipt.Logs))
+		for _, l := range receipt.Logs {
+			fmt.Printf("  [%d] %s\n", l.Index, describeLog(lending, usdcToken, *l))
+		}
+	}
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		return
+	}
+
+	// Receipts carry no revert data, so replay the call on the parent block's state. Earlier transactions in
+	// the same block are not replayed, so the reason can differ when they affected this one.
+	msg := ethereum.CallMsg{From: from, To: tx.To(), Gas: tx.Gas(), Value: tx.Value(), Data: tx.Data()}
+	_, err = client.CallContract(ctx, msg, new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1)))
+	if err == nil {
+		fmt.Println("\nRevert: the replay on the parent block succeeded; the failure depends on earlier transactions in the block or on gas")
+		return
+	}
+	if data, ok := revertData(err); ok {
+		fmt.Println("\nRevert:", decodeRevert(data))
+	} else {
+		fmt.Println("\nRevert:", err)
+	}
+}
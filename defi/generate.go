@@ -0,0 +1,3 @@
+package defi
+
+//go:generate go run ../cmd/genbindings -contract DeFiLending -pkg defi -type Defi -out defi_lending.go
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+
+	"defi-lending/artifact"
+	"defi-lending/defi"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// defaultArtifactsDir is where the Foundry project under contracts/ writes its artifacts.
+const defaultArtifactsDir = "contracts/out"
+
+// deployBackend is what deploySystem needs from a node; both ethclient.Client and the
+// simulated backend's client satisfy it.
+type deployBackend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+}
+
+// deployArtifacts are the compiled contracts making up the lending system.
+type deployArtifacts struct {
+	Token          *artifact.Artifact
+	Implementation *artifact.Artifact
+	Proxy          *artifact.Artifact
+}
+
+// deployment is the result of deploySystem.
+type deployment struct {
+	Token          common.Address
+	Implementation common.Address
+	Proxy          common.Address
+	Block          uint64 // block of the proxy deployment
+}
+
+// deploySystem deploys the token with initialSupply, the lending implementation and an ERC1967 proxy
+// whose constructor calls initialize(token), waiting for each contract before sending the next.
+func deploySystem(ctx context.Context, backend deployBackend, auth *bind.TransactOpts, arts *deployArtifacts, initialSupply *big.Int) (*deployment, error) {
+	deploy := func(a *artifact.Artifact, params ...interface{}) (common.Address, *types.Receipt, error) {
+		if len(a.Bytecode) == 0 {
+			return common.Address{}, nil, fmt.Errorf("%s: artifact has no bytecode (abstract contract or interface?)", a.Path)
+		}
+		addr, tx, _, err := bind.DeployContract(auth, a.ABI, a.Bytecode, backend, params...)
+		if err != nil {
+			return common.Address{}, nil, fmt.Errorf("deploy %s: %w", a.Name, err)
+		}
+		fmt.Printf("Deploying %s, tx hash: %s\n", a.Name, tx.Hash().Hex())
+		if _, err := bind.WaitDeployed(ctx, backend, tx); err != nil {
+			return common.Address{}, nil, fmt.Errorf("deploy %s: %w", a.Name, err)
+		}
+		receipt, err := backend.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return common.Address{}, nil, err
+		}
+		fmt.Printf("%s deployed at %s (block %s)\n", a.Name, addr.Hex(), receipt.BlockNumber)
+		return addr, receipt, nil
+	}
+
+	d := &deployment{}
+	var err error
+	if d.Token, _, err = deploy(arts.Token, initialSupply); err != nil {
+		return nil, err
+	}
+	if d.Implementation, _, err = deploy(arts.Implementation); err != nil {
+		return nil, err
+	}
+	// Initializing in the proxy constructor leaves no window for someone else to call initialize first.
+	initData, err := arts.Implementation.ABI.Pack("initialize", d.Token)
+	if err != nil {
+		return nil, fmt.Errorf("encode initialize: %w", err)
+	}
+	var receipt *types.Receipt
+	if d.Proxy, receipt, err = deploy(arts.Proxy, d.Implementation, initData); err != nil {
+		return nil, err
+	}
+	d.Block = receipt.BlockNumber.Uint64()
+	return d, nil
+}
+
+// runDeploy implements the deploy subcommand.
+func runDeploy(client *ethclient.Client, args []string) {
+	deployCmd := flag.NewFlagSet("deploy", flag.ExitOnError)
+	artifactsFlag := deployCmd.String("artifacts", envOr("ARTIFACTS_DIR", defaultArtifactsDir), "Directory with Foundry (out/) or Hardhat (artifacts/) JSON artifacts (default $ARTIFACTS_DIR or "+defaultArtifactsDir+")")
+	tokenFlag := deployCmd.String("token-contract", "uSDC", "Contract name of the token artifact")
+	lendingFlag := deployCmd.String("lending-contract", "DeFiLending", "Contract name of the lending implementation artifact")
+	proxyFlag := deployCmd.String("proxy-contract", "ERC1967Proxy", "Contract name of the proxy artifact")
+	supplyFlag := deployCmd.String("initial-supply", "1000000", "Token initialSupply in whole tokens, minted to the deployer")
+	networkFlag := deployCmd.String("network", "", "Network name; the profile is written to profiles/<network>.json")
+	privateKeyFlag := deployCmd.String("private-key", "", "Private key of the deployer, which becomes the owner")
+	overwriteFlag := deployCmd.Bool("overwrite", false, "Replace an existing profile for the network")
+	deployCmd.BoolVar(&assumeYes, "yes", false, "Skip the confirmation prompts")
+	var gas gasPolicy
+	gas.register(deployCmd)
+	deployCmd.Parse(args)
+
+	if *networkFlag == "" || *privateKeyFlag == "" {
+		fmt.Println("Usage: deploy --network <name> --private-key <private-key> [--artifacts contracts/out] [--initial-supply 1000000] [--yes]")
+		os.Exit(1)
+	}
+	path := profilePath(*networkFlag)
+	if _, err := os.Stat(path); err == nil && !*overwriteFlag {
+		log.Fatalf("Profile %s already exists; pass --overwrite to replace it", path)
+	}
+	supply, err := parseToken(*supplyFlag)
+	if err != nil {
+		log.Fatal("Invalid initial supply:", err)
+	}
+	arts := &deployArtifacts{}
+	for _, a := range []struct {
+		name string
+		dst  **artifact.Artifact
+	}{
+		{*tokenFlag, &arts.Token},
+		{*lendingFlag, &arts.Implementation},
+		{*proxyFlag, &arts.Proxy},
+	} {
+		if *a.dst, err = artifact.Load(*artifactsFlag, a.name); err != nil {
+			log.Fatal("Failed to load artifact:", err)
+		}
+	}
+
+	ctx := context.Background()
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		log.Fatal("Failed to get chain ID:", err)
+	}
+	auth, err := chainTransactor(client, *privateKeyFlag)
+	if err != nil {
+		log.Fatal("Failed to create transactor:", err)
+	}
+	gas.apply(auth)
+	auth.Context = ctx
+
+	d, err := deploySystem(ctx, client, auth, arts, supply)
+	if err != nil {
+		log.Fatal("Deployment failed:", err)
+	}
+
+	// Confirm the proxy was initialized by the deployer with the new token.
+	lending, err := defi.NewDefi(d.Proxy, client)
+	if err != nil {
+		log.Fatal("Failed to bind proxy:", err)
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	owner, err := lending.Owner(opts)
+	if err != nil {
+		log.Fatal("Failed to get owner:", err)
+	}
+	token, err := lending.Token(opts)
+	if err != nil {
+		log.Fatal("Failed to get token:", err)
+	}
+	if owner != auth.From || token != d.Token {
+		log.Fatalf("Proxy is not initialized as expected: owner %s, token %s", owner.Hex(), token.Hex())
+	}
+	code, err := client.CodeAt(ctx, d.Implementation, nil)
+	if err != nil {
+		log.Fatal("Failed to get implementation code:", err)
+	}
+
+	profile := &networkProfile{
+		Network:                *networkFlag,
+		ChainID:                chainID.Uint64(),
+		Lending:                d.Proxy,
+		Token:                  d.Token,
+		Implementation:         d.Implementation,
+		ImplementationCodeHash: crypto.Keccak256Hash(code),
+		DeployBlock:            d.Block,
+	}
+	if err := writeProfile(path, profile); err != nil {
+		log.Fatal("Failed to write profile:", err)
+	}
+	fmt.Printf("\nLending (proxy): %s\nImplementation:  %s\nToken:           %s\nOwner:           %s\n", d.Proxy.Hex(), d.Implementation.Hex(), d.Token.Hex(), owner.Hex())
+	fmt.Printf("Profile written to %s; use it with --profile %s\n", path, *networkFlag)
+}
+
+// envOr returns an environment variable, or def when it is unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"defi-lending/artifact"
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// stubBytecode is init code that ignores its constructor arguments and deploys a one-byte runtime (STOP), so
+// deploySystem can be run without the Foundry artifacts.
+var stubBytecode = []byte{
+	0x60, 0x01, 0x60, 0x0c, 0x60, 0x00, 0x39, // CODECOPY(0, 12, 1)
+	0x60, 0x01, 0x60, 0x00, 0xf3, // RETURN(0, 1)
+	0x00, // runtime: STOP
+}
+
+const proxyABI = `[{"type":"constructor","inputs":[{"name":"implementation","type":"address"},{"name":"_data","type":"bytes"}]}]`
+
+// testArtifacts builds artifacts with the real ABIs and stub bytecode.
+func testArtifacts(t *testing.T) *deployArtifacts {
+	t.Helper()
+	build := func(name, rawABI string) *artifact.Artifact {
+		parsed, err := abi.JSON(strings.NewReader(rawABI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &artifact.Artifact{Name: name, Path: name + ".json", ABI: parsed, Bytecode: stubBytecode}
+	}
+	return &deployArtifacts{
+		Token:          build("uSDC", usdc.UsdcMetaData.ABI),
+		Implementation: build("DeFiLending", defi.DefiMetaData.ABI),
+		Proxy:          build("ERC1967Proxy", proxyABI),
+	}
+}
+
+// newSimulatedDeployer returns a simulated backend funding a fresh key and a transactor for that key. The
+// backend mines a block every few milliseconds so deploySystem's waits return.
+func newSimulatedDeployer(t *testing.T) (*simulated.Backend, *bind.TransactOpts) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := bind.NewKeyedTransactorWithChainID(key, params.AllDevChainProtocolChanges.ChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance := new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))
+	backend := simulated.NewBackend(types.GenesisAlloc{auth.From: {Balance: balance}})
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				backend.Commit()
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+		backend.Close()
+	})
+	return backend, auth
+}
+
+func TestDeploySystemSimulated(t *testing.T) {
+	backend, auth := newSimulatedDeployer(t)
+	client := backend.Client()
+	arts := testArtifacts(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	d, err := deploySystem(ctx, client, auth, arts, big.NewInt(1_000_000e6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Token == d.Implementation || d.Token == d.Proxy || d.Implementation == d.Proxy {
+		t.Fatalf("deployment reuses an address: %+v", d)
+	}
+	for name, addr := range map[string]common.Address{"token": d.Token, "implementation": d.Implementation, "proxy": d.Proxy} {
+		code, err := client.CodeAt(ctx, addr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) == 0 {
+			t.Errorf("%s %s has no code", name, addr.Hex())
+		}
+	}
+
+	// The proxy is created in d.Block with initialize(token) passed to its constructor.
+	block, err := client.BlockByNumber(ctx, new(big.Int).SetUint64(d.Block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proxyTx *types.Transaction
+	for _, tx := range block.Transactions() {
+		receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipt.ContractAddress == d.Proxy {
+			proxyTx = tx
+		}
+	}
+	if proxyTx == nil {
+		t.Fatalf("no proxy creation in block %d", d.Block)
+	}
+	initData, err := arts.Implementation.ABI.Pack("initialize", d.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := arts.Proxy.ABI.Pack("", d.Implementation, initData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(append([]byte{}, stubBytecode...), args...); !bytes.Equal(proxyTx.Data(), want) {
+		t.Errorf("proxy constructor data = %x, want %x", proxyTx.Data(), want)
+	}
+}
+
+func TestDeploySystemRejectsMissingBytecode(t *testing.T) {
+	backend, auth := newSimulatedDeployer(t)
+	arts := testArtifacts(t)
+	arts.Implementation.Bytecode = nil
+
+	_, err := deploySystem(context.Background(), backend.Client(), auth, arts, big.NewInt(1))
+	if err == nil || !strings.Contains(err.Error(), "has no bytecode") {
+		t.Fatalf("deploySystem error = %v, want missing bytecode", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// decodedEvent is a contract log decoded generically against an ABI.
+type decodedEvent struct {
+	Name        string                 `json:"event"`
+	Fields      map[string]interface{} `json:"fields"`
+	BlockNumber uint64                 `json:"blockNumber"`
+	TxHash      common.Hash            `json:"txHash"`
+	LogIndex    uint                   `json:"logIndex"`
+}
+
+// decodeEvent decodes both the indexed and non-indexed arguments of a log.
+func decodeEvent(parsed *abi.ABI, l types.Log) (*decodedEvent, error) {
+	if len(l.Topics) == 0 {
+		return nil, fmt.Errorf("anonymous log")
+	}
+	evt, err := parsed.EventByID(l.Topics[0])
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if len(l.Data) > 0 {
+		if err := parsed.UnpackIntoMap(fields, evt.Name, l.Data); err != nil {
+			return nil, err
+		}
+	}
+	var indexed abi.Arguments
+	for _, arg := range evt.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(fields, indexed, l.Topics[1:]); err != nil {
+		return nil, err
+	}
+	return &decodedEvent{
+		Name:        evt.Name,
+		Fields:      fields,
+		BlockNumber: l.BlockNumber,
+		TxHash:      l.TxHash,
+		LogIndex:    l.Index,
+	}, nil
+}
+
+// fetchLogs returns the logs of a contract in a block range, split into maxLogRange chunks.
+func fetchLogs(ctx context.Context, client *ethclient.Client, contract common.Address, from, to uint64, topics [][]common.Hash) ([]types.Log, error) {
+	var logs []types.Log
+	for start := from; start <= to; start += maxLogRange {
+		end := min(start+maxLogRange-1, to)
+		chunk, err := client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: []common.Address{contract},
+			Topics:    topics,
+		})
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, chunk...)
+	}
+	return logs, nil
+}
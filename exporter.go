@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// exporter serves market and position state in the Prometheus text exposition format.
+type exporter struct {
+	client    *ethclient.Client
+	lending   *defi.Defi
+	usdcToken *usdc.Usdc
+	parsedABI *abi.ABI
+	watched   []common.Address
+	batch     *batcher
+
+	mu          sync.Mutex
+	page        []byte
+	eventCounts map[string]uint64
+}
+
+// runExporter implements the exporter subcommand.
+func runExporter(client *ethclient.Client, lending *defi.Defi, usdcToken *usdc.Usdc, args []string) {
+	exporterCmd := flag.NewFlagSet("exporter", flag.ExitOnError)
+	listenFlag := exporterCmd.String("listen", ":9464", "Address to serve /metrics on")
+	watchFlag := exporterCmd.String("watch", "", "Comma-separated addresses to export per-position metrics for")
+	everyFlag := exporterCmd.Uint64("every", 1, "Refresh metrics every N blocks")
+	intervalFlag := exporterCmd.Duration("interval", 12*time.Second, "How often to poll for new blocks")
+	exporterCmd.Parse(args)
+
+	watched, err := parseAddressList(*watchFlag)
+	if err != nil {
+		log.Fatal("Invalid --watch list:", err)
+	}
+	parsedABI, err := defi.DefiMetaData.GetAbi()
+	if err != nil {
+		log.Fatal("Failed to parse DeFiLending ABI:", err)
+	}
+	e := &exporter{
+		client:      client,
+		lending:     lending,
+		usdcToken:   usdcToken,
+		parsedABI:   parsedABI,
+		watched:     watched,
+		eventCounts: map[string]uint64{},
+		batch:       newBatcher(client),
+	}
+	for _, evt := range parsedABI.Events {
+		e.eventCounts[evt.Name] = 0
+	}
+
+	ctx := context.Background()
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		log.Fatal("Failed to get latest block:", err)
+	}
+	if err := e.refresh(ctx, head); err != nil {
+		log.Fatal("Failed to collect metrics:", err)
+	}
+	go e.poll(ctx, head, *everyFlag, *intervalFlag)
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		e.mu.Lock()
+		page := e.page
+		e.mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(page)
+	})
+	fmt.Println("Serving metrics on", *listenFlag+"/metrics")
+	log.Fatal(http.ListenAndServe(*listenFlag, nil))
+}
+
+// poll counts events in every new block and refreshes the gauges every N blocks.
+func (e *exporter) poll(ctx context.Context, last, every uint64, interval time.Duration) {
+	if every == 0 {
+		every = 1
+	}
+	lendingAddr := common.HexToAddress(contractAddress)
+	refreshed := last
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		head, err := e.client.BlockNumber(ctx)
+		if err != nil {
+			log.Println("Failed to get latest block:", err)
+			continue
+		}
+		if head <= last {
+			continue
+		}
+		// Count in maxLogRange chunks, advancing past each one, so catching up after downtime makes progress.
+		for last < head {
+			end := min(last+maxLogRange, head)
+			logs, err := fetchLogs(ctx, e.client, lendingAddr, last+1, end, nil)
+			if err != nil {
+				log.Println("Failed to fetch lending events:", err)
+				break
+			}
+			e.mu.Lock()
+			for _, l := range logs {
+				if len(l.Topics) == 0 {
+					continue
+				}
+				if evt, err := e.parsedABI.EventByID(l.Topics[0]); err == nil {
+					e.eventCounts[evt.Name]++
+				}
+			}
+			e.mu.Unlock()
+			last = end
+		}
+		if last < head {
+			continue
+		}
+
+		if head-refreshed < every {
+			continue
+		}
+		if err := e.refresh(ctx, head); err != nil {
+			log.Println("Failed to collect metrics:", err)
+			continue
+		}
+		refreshed = head
+	}
+}
+
+// refresh reads market and position state at a block and re-renders the metrics page.
+func (e *exporter) refresh(ctx context.Context, block uint64) error {
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(block)}
+	m, err := loadMarket(e.lending, e.usdcToken, opts)
+	if err != nil {
+		return err
+	}
+	positions, errs, err := loadPositions(ctx, e.batch, e.watched, opts.BlockNumber)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	writeMetric(&buf, "defi_block_number", "gauge", "Block the metrics were read at.", nil, new(big.Float).SetUint64(block))
+	writeMetric(&buf, "defi_total_deposits_tokens", "gauge", "TotalDeposits in whole uSDC.", nil, tokenFloat(m.TotalDeposits))
+	writeMetric(&buf, "defi_total_borrows_tokens", "gauge", "TotalBorrows in whole uSDC.", nil, tokenFloat(m.TotalBorrows))
+	writeMetric(&buf, "defi_total_deposit_shares", "gauge", "TotalDepositShares.", nil, new(big.Float).SetInt(m.TotalDepositShares))
+	writeMetric(&buf, "defi_deposit_index", "gauge", "DepositIndex as returned by the contract.", nil, new(big.Float).SetInt(m.DepositIndex))
+	writeMetric(&buf, "defi_interest_rate", "gauge", "InterestRate as returned by the contract.", nil, new(big.Float).SetInt(m.InterestRate))
+	writeMetric(&buf, "defi_utilization_ratio", "gauge", "TotalBorrows divided by TotalDeposits.", nil, m.Utilization())
+	writeMetric(&buf, "defi_liquidation_threshold_percent", "gauge", "LiquidationThreshold in percent.", nil, new(big.Float).SetInt(m.Threshold))
+	writeMetric(&buf, "defi_contract_token_balance_tokens", "gauge", "uSDC balance held by the lending contract.", nil, tokenFloat(m.Liquidity))
+
+	// A position that fails to load is skipped and flagged so the other metrics stay fresh.
+	var loaded []*position
+	for i, pos := range positions {
+		failed := 0.0
+		if errs[i] != nil {
+			log.Printf("Failed to read position of %s: %v", e.watched[i].Hex(), errs[i])
+			failed = 1
+		} else {
+			loaded = append(loaded, pos)
+		}
+		writeMetric(&buf, "defi_position_read_error", "gauge", "1 if the position of a watched address could not be read at the block.", map[string]string{"address": e.watched[i].Hex()}, big.NewFloat(failed))
+	}
+	// Each metric is written as one group, as the exposition format requires.
+	for _, pos := range loaded {
+		writeMetric(&buf, "defi_position_deposit_tokens", "gauge", "Deposit of a watched address in whole uSDC.", map[string]string{"address": pos.User.Hex()}, tokenFloat(pos.Deposit))
+	}
+	for _, pos := range loaded {
+		writeMetric(&buf, "defi_position_debt_tokens", "gauge", "Principal plus accrued interest of a watched address in whole uSDC.", map[string]string{"address": pos.User.Hex()}, tokenFloat(pos.Debt()))
+	}
+	for _, pos := range loaded {
+		if hf := pos.HealthFactor(); hf != nil {
+			writeMetric(&buf, "defi_position_health_factor", "gauge", "Health factor of a watched address.", map[string]string{"address": pos.User.Hex()}, hf)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	names := make([]string, 0, len(e.eventCounts))
+	for name := range e.eventCounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeMetric(&buf, "defi_events_total", "counter", "Lending contract events observed since the exporter started.", map[string]string{"event": name}, new(big.Float).SetUint64(e.eventCounts[name]))
+	}
+	e.page = buf.Bytes()
+	return nil
+}
+
+// writeMetric appends one sample in the Prometheus text format, emitting HELP and TYPE once per metric.
+func writeMetric(buf *bytes.Buffer, name, kind, help string, labels map[string]string, value *big.Float) {
+	if !bytes.Contains(buf.Bytes(), []byte("# TYPE "+name+" ")) {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = fmt.Sprintf("%s=%q", k, labels[k])
+		}
+		buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	fmt.Fprintf(buf, " %s\n", value.Text('g', 10))
+}
+
+// tokenFloat converts uSDC base units to whole tokens.
+func tokenFloat(amount *big.Int) *big.Float {
+	return new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(tokenUnit))
+}
+
+// ratio returns a/b, or zero when b is zero.
+func ratio(a, b *big.Int) *big.Float {
+	if b.Sign() == 0 {
+		return new(big.Float)
+	}
+	return new(big.Float).Quo(new(big.Float).SetInt(a), new(big.Float).SetInt(b))
+}
+
+// parseAddressList parses a comma-separated list of hex addresses.
+func parseAddressList(s string) ([]common.Address, error) {
+	var out []common.Address
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !common.IsHexAddress(part) {
+			return nil, fmt.Errorf("invalid address %q", part)
+		}
+		out = append(out, common.HexToAddress(part))
+	}
+	return out, nil
+}
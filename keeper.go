@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// maxLogRange is the largest block range requested in a single eth_getLogs call.
+const maxLogRange = 5000
+
+// keeperOutcome is one JSON line of the keeper's outcome log.
+type keeperOutcome struct {
+	Time             time.Time `json:"time"`
+	Block            uint64    `json:"block"`
+	User             string    `json:"user"`
+	Status           string    `json:"status"`
+	Debt             string    `json:"debt"`
+	Deposit          string    `json:"deposit"`
+	GasCost          string    `json:"gasCost,omitempty"`
+	ApproveTx        string    `json:"approveTx,omitempty"`
+	TxHash           string    `json:"txHash,omitempty"`
+	CollateralSeized string    `json:"collateralSeized,omitempty"`
+	Repaid           string    `json:"repaid,omitempty"`
+	Reward           string    `json:"reward,omitempty"`
+	RewardSource     string    `json:"rewardSource,omitempty"` // trace, estimate or receipt
+	Error            string    `json:"error,omitempty"`
+}
+
+// keeper watches the lending contract and liquidates unhealthy positions.
+type keeper struct {
+	client      *ethclient.Client
+	lending     *defi.Defi
+	usdcToken   *usdc.Usdc
+	parsedABI   *abi.ABI
+	auth        *bind.TransactOpts
+	gas         gasPolicy
+	ethPrice    float64
+	minProfit   *big.Int
+	autoApprove bool
+	dryRun      bool
+	tracked     map[common.Address]bool
+	outcomes    *json.Encoder
+	batch       *batcher
+}
+
+// runKeeper implements the keeper subcommand.
+func runKeeper(client *ethclient.Client, lending *defi.Defi, usdcToken *usdc.Usdc, args []string) {
+	keeperCmd := flag.NewFlagSet("keeper", flag.ExitOnError)
+	privateKeyFlag := keeperCmd.String("private-key", "", "Private key used to sign liquidations")
+	intervalFlag := keeperCmd.Duration("interval", 12*time.Second, "How often to poll for new blocks")
+	fromBlockFlag := keeperCmd.Uint64("from-block", 0, "Block to start discovering borrowers from (default: the lending contract's Initialized event)")
+	fullEveryFlag := keeperCmd.Uint64("full-every", 50, "Re-evaluate every tracked position each N blocks, since interest accrues without events")
+	ethPriceFlag := keeperCmd.Float64("eth-price", 0, "Price of 1 ETH in uSDC, used to convert gas cost (0 ignores gas cost)")
+	minProfitFlag := keeperCmd.String("min-profit", "0", "Minimum expected profit in whole uSDC tokens")
+	logFlag := keeperCmd.String("log", "keeper.log", "File to append liquidation outcomes to (JSON lines)")
+	autoApproveFlag := keeperCmd.Bool("auto-approve", false, "Approve the lending contract to pull the debt when the uSDC allowance is short")
+	dryRunFlag := keeperCmd.Bool("dry-run", false, "Simulate and log liquidations without sending them")
+	k := &keeper{client: client, lending: lending, usdcToken: usdcToken, tracked: map[common.Address]bool{}, batch: newBatcher(client)}
+	k.gas.register(keeperCmd)
+	keeperCmd.Parse(args)
+
+	if *privateKeyFlag == "" {
+		fmt.Println("Usage: keeper --private-key <private-key> [--interval 12s] [--from-block <n>] [--dry-run]")
+		os.Exit(1)
+	}
+
+	// The daemon signs unattended; --dry-run is its preview.
+	unattended = true
+	var err error
+	if k.auth, err = newTransactor(client, *privateKeyFlag); err != nil {
+		log.Fatal("Failed to create transactor:", err)
+	}
+	k.gas.apply(k.auth)
+	if k.parsedABI, err = defi.DefiMetaData.GetAbi(); err != nil {
+		log.Fatal("Failed to parse DeFiLending ABI:", err)
+	}
+	minProfit, ok := new(big.Float).SetString(*minProfitFlag)
+	if !ok {
+		log.Fatal("Invalid --min-profit value")
+	}
+	k.minProfit, _ = minProfit.Mul(minProfit, new(big.Float).SetInt(tokenUnit)).Int(nil)
+	k.ethPrice, k.autoApprove, k.dryRun = *ethPriceFlag, *autoApproveFlag, *dryRunFlag
+
+	logFile, err := os.OpenFile(*logFlag, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Fatal("Failed to open outcome log:", err)
+	}
+	defer logFile.Close()
+	k.outcomes = json.NewEncoder(logFile)
+
+	ctx := context.Background()
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		log.Fatal("Failed to get latest block:", err)
+	}
+	// Discover every borrower since deployment, so positions that are already underwater are evaluated
+	// without waiting for them to emit a new event.
+	start := *fromBlockFlag
+	if start == 0 {
+		if start, err = inceptionBlock(ctx, client, lending, head); err != nil {
+			log.Fatal("Failed to find the Initialized event, pass --from-block:", err)
+		}
+	}
+	if start > head {
+		start = head
+	}
+	if _, err := k.index(ctx, start, head); err != nil {
+		log.Fatal("Failed to index lending events:", err)
+	}
+	fmt.Printf("Keeper started at block %d as %s, tracking %d accounts\n", head, k.auth.From.Hex(), len(k.tracked))
+	k.evaluate(ctx, head, k.trackedList())
+
+	ticker := time.NewTicker(*intervalFlag)
+	defer ticker.Stop()
+	last := head
+	for range ticker.C {
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			log.Println("Failed to get latest block:", err)
+			continue
+		}
+		if head <= last {
+			continue
+		}
+		affected, err := k.index(ctx, last+1, head)
+		if err != nil {
+			log.Println("Failed to index lending events:", err)
+			continue
+		}
+		if *fullEveryFlag > 0 && head/(*fullEveryFlag) != last/(*fullEveryFlag) {
+			affected = k.trackedList()
+		}
+		k.evaluate(ctx, head, affected)
+		last = head
+	}
+}
+
+// index records every account with a Borrowed, Repaid or Deposited event in the range and returns them.
+func (k *keeper) index(ctx context.Context, from, to uint64) ([]common.Address, error) {
+	seen := map[common.Address]bool{}
+	for start := from; start <= to; start += maxLogRange {
+		end := min(start+maxLogRange-1, to)
+		opts := &bind.FilterOpts{Start: start, End: &end, Context: ctx}
+
+		borrowed, err := k.lending.FilterBorrowed(opts, nil)
+		if err != nil {
+			return nil, err
+		}
+		for borrowed.Next() {
+			seen[borrowed.Event.User] = true
+		}
+		err = borrowed.Error()
+		borrowed.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		repaid, err := k.lending.FilterRepaid(opts, nil)
+		if err != nil {
+			return nil, err
+		}
+		for repaid.Next() {
+			seen[repaid.Event.User] = true
+		}
+		err = repaid.Error()
+		repaid.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		deposited, err := k.lending.FilterDeposited(opts, nil)
+		if err != nil {
+			return nil, err
+		}
+		for deposited.Next() {
+			seen[deposited.Event.User] = true
+		}
+		err = deposited.Error()
+		deposited.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	affected := make([]common.Address, 0, len(seen))
+	for user := range seen {
+		k.tracked[user] = true
+		affected = append(affected, user)
+	}
+	return affected, nil
+}
+
+// trackedList returns every account the keeper knows about.
+func (k *keeper) trackedList() []common.Address {
+	users := make([]common.Address, 0, len(k.tracked))
+	for user := range k.tracked {
+		users = append(users, user)
+	}
+	return users
+}
+
+// evaluate re-reads the given positions at a block and liquidates the ones below the threshold.
+func (k *keeper) evaluate(ctx context.Context, block uint64, users []common.Address) {
+	positions, errs, err := loadPositions(ctx, k.batch, users, new(big.Int).SetUint64(block))
+	if err != nil {
+		log.Println("Failed to read positions:", err)
+		return
+	}
+	for i, user := range users {
+		pos := positions[i]
+		if errs[i] != nil {
+			log.Printf("Failed to read position of %s: %v", user.Hex(), errs[i])
+			continue
+		}
+		if pos.Principal.Sign() == 0 {
+			delete(k.tracked, user)
+			continue
+		}
+		if !pos.Liquidatable() {
+			continue
+		}
+		k.liquidate(ctx, block, pos)
+	}
+}
+
+// liquidate simulates, prices and, if profitable, submits a liquidation, logging the outcome.
+func (k *keeper) liquidate(ctx context.Context, block uint64, pos *position) {
+	outcome := keeperOutcome{
+		Time:    time.Now().UTC(),
+		Block:   block,
+		User:    pos.User.Hex(),
+		Debt:    formatToken(pos.Debt()),
+		Deposit: formatToken(pos.Deposit),
+	}
+	defer func() {
+		if err := k.outcomes.Encode(outcome); err != nil {
+			log.Println("Failed to write outcome log:", err)
+		}
+		fmt.Printf("[block %d] %s %s %s\n", block, outcome.Status, outcome.User, outcome.Error)
+	}()
+
+	// The liquidator repays the debt from its own uSDC, so check it can before simulating.
+	opts := &bind.CallOpts{Context: ctx}
+	lendingAddr := common.HexToAddress(contractAddress)
+	debt := pos.Debt()
+	balance, err := k.usdcToken.BalanceOf(opts, k.auth.From)
+	if err != nil {
+		outcome.Status, outcome.Error = "error", err.Error()
+		return
+	}
+	if balance.Cmp(debt) < 0 {
+		outcome.Status, outcome.Error = "insufficient-balance", fmt.Sprintf("uSDC balance %s is below the debt", formatToken(balance))
+		return
+	}
+	allowance, err := k.usdcToken.Allowance(opts, k.auth.From, lendingAddr)
+	if err != nil {
+		outcome.Status, outcome.Error = "error", err.Error()
+		return
+	}
+	if allowance.Cmp(debt) < 0 {
+		if !k.autoApprove || k.dryRun {
+			outcome.Status, outcome.Error = "insufficient-allowance", fmt.Sprintf("uSDC allowance %s is below the debt; approve the lending contract or run with --auto-approve", formatToken(allowance))
+			return
+		}
+		// Interest keeps accruing until the liquidation is mined, so leave 1% of headroom.
+		amount := new(big.Int).Div(new(big.Int).Mul(debt, big.NewInt(101)), big.NewInt(100))
+		approveTx, err := k.usdcToken.Approve(k.auth, lendingAddr, amount)
+		if err != nil {
+			outcome.Status, outcome.Error = "approve-failed", err.Error()
+			return
+		}
+		outcome.ApproveTx = approveTx.Hash().Hex()
+		if receipt, err := bind.WaitMined(ctx, k.client, approveTx); err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+			outcome.Status, outcome.Error = "approve-failed", fmt.Sprint("approval not confirmed: ", err)
+			return
+		}
+	}
+
+	// Simulate Liquidate(user) so a reverting liquidation never costs gas, and read what it would seize and repay.
+	data, err := k.parsedABI.Pack("liquidate", pos.User)
+	if err != nil {
+		outcome.Status, outcome.Error = "error", err.Error()
+		return
+	}
+	msg := ethereum.CallMsg{From: k.auth.From, To: &lendingAddr, Data: data}
+	var reward *big.Int
+	amounts, revert, err := k.traceLiquidation(ctx, msg)
+	switch {
+	case err == nil && revert != "":
+		outcome.Status, outcome.Error = "simulation-reverted", revert
+		return
+	case err == nil:
+		reward = new(big.Int).Sub(amounts.Seized, amounts.Repaid)
+		outcome.CollateralSeized, outcome.Repaid, outcome.RewardSource = formatToken(amounts.Seized), formatToken(amounts.Repaid), "trace"
+	default:
+		// Without the debug API, fall back to eth_call and assume the whole deposit is seized for the whole debt.
+		if _, err := k.client.CallContract(ctx, msg, nil); err != nil {
+			outcome.Status, outcome.Error = "simulation-reverted", err.Error()
+			return
+		}
+		reward = new(big.Int).Sub(pos.Deposit, debt)
+		outcome.RewardSource = "estimate"
+	}
+	gasLimit, err := k.client.EstimateGas(ctx, msg)
+	if err != nil {
+		outcome.Status, outcome.Error = "estimate-failed", err.Error()
+		return
+	}
+
+	if k.ethPrice > 0 {
+		feeCap, err := k.gas.maxFeePerGas(ctx, k.client)
+		if err != nil {
+			outcome.Status, outcome.Error = "error", err.Error()
+			return
+		}
+		gasWei := new(big.Int).Mul(feeCap, new(big.Int).SetUint64(gasLimit))
+		gasCost := weiToToken(gasWei, k.ethPrice)
+		outcome.GasCost = formatToken(gasCost)
+		reward.Sub(reward, gasCost)
+	}
+	outcome.Reward = formatToken(reward)
+	if reward.Cmp(k.minProfit) < 0 {
+		outcome.Status = "unprofitable"
+		return
+	}
+	if k.dryRun {
+		outcome.Status = "dry-run"
+		return
+	}
+
+	tx, err := k.lending.Liquidate(k.auth, pos.User)
+	if err != nil {
+		outcome.Status, outcome.Error = "send-failed", err.Error()
+		return
+	}
+	outcome.TxHash = tx.Hash().Hex()
+	receipt, err := bind.WaitMined(ctx, k.client, tx)
+	if err != nil {
+		outcome.Status, outcome.Error = "wait-failed", err.Error()
+		return
+	}
+	if receipt.Status == 0 {
+		outcome.Status = "reverted"
+		return
+	}
+	outcome.Status = "liquidated"
+	logs := make([]types.Log, len(receipt.Logs))
+	for i, l := range receipt.Logs {
+		logs[i] = *l
+	}
+	realized := k.liquidationAmounts(logs)
+	outcome.CollateralSeized, outcome.Repaid, outcome.RewardSource = formatToken(realized.Seized), formatToken(realized.Repaid), "receipt"
+	outcome.Reward = formatToken(new(big.Int).Sub(realized.Seized, realized.Repaid))
+}
+
+// liquidationResult is what a liquidation moved: the collateral seized and the uSDC the keeper repaid.
+type liquidationResult struct {
+	Seized *big.Int
+	Repaid *big.Int
+}
+
+// liquidationAmounts reads the collateral seized from the Liquidated event and the debt repaid from uSDC
+// transfers out of the keeper's account.
+func (k *keeper) liquidationAmounts(logs []types.Log) *liquidationResult {
+	res := &liquidationResult{Seized: new(big.Int), Repaid: new(big.Int)}
+	lendingAddr, tokenAddr := common.HexToAddress(contractAddress), common.HexToAddress(usdcContractAddress)
+	for _, l := range logs {
+		switch {
+		case l.Address == lendingAddr:
+			if evt, err := k.lending.ParseLiquidated(l); err == nil {
+				res.Seized.Add(res.Seized, evt.CollateralSeized)
+			}
+		case l.Address == tokenAddr:
+			if evt, err := k.usdcToken.ParseTransfer(l); err == nil && evt.From == k.auth.From {
+				res.Repaid.Add(res.Repaid, evt.Value)
+			}
+		}
+	}
+	return res
+}
+
+// traceLiquidation runs a liquidation with debug_traceCall. It returns the amounts from the logs of the
+// successful frames, or the revert reason if the call fails; err is set when the node cannot trace.
+func (k *keeper) traceLiquidation(ctx context.Context, msg ethereum.CallMsg) (*liquidationResult, string, error) {
+	call := map[string]interface{}{"from": msg.From, "to": msg.To, "data": hexutil.Bytes(msg.Data)}
+	config := map[string]interface{}{"tracer": "callTracer", "tracerConfig": map[string]bool{"withLog": true}}
+	var root callFrame
+	if err := k.client.Client().CallContext(ctx, &root, "debug_traceCall", call, "latest", config); err != nil {
+		return nil, "", err
+	}
+	if root.Error != "" {
+		reason := root.Error
+		if len(root.Output) > 0 {
+			reason = decodeRevert(root.Output)
+		}
+		return nil, reason, nil
+	}
+	var logs []types.Log
+	var collect func(f *callFrame)
+	collect = func(f *callFrame) {
+		if f.Error != "" {
+			return // reverted frames leave no logs
+		}
+		for _, l := range f.Logs {
+			logs = append(logs, types.Log{Address: l.Address, Topics: l.Topics, Data: l.Data})
+		}
+		for i := range f.Calls {
+			collect(&f.Calls[i])
+		}
+	}
+	collect(&root)
+	return k.liquidationAmounts(logs), "", nil
+}
+
+// weiToToken converts an amount of wei into uSDC base units at the given ETH price.
+func weiToToken(wei *big.Int, ethPrice float64) *big.Int {
+	v := new(big.Float).SetInt(wei)
+	v.Mul(v, big.NewFloat(ethPrice))
+	v.Mul(v, new(big.Float).SetInt(tokenUnit))
+	v.Quo(v, big.NewFloat(1e18))
+	out, _ := v.Int(nil)
+	return out
+}
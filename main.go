@@ -7,38 +7,55 @@ import (
 	"log"
 	"math/big"
 	"os"
-	"strings"
 	"time"
 
 	"defi-lending/defi" // Go binding package for your DeFiLending contract
 	"defi-lending/usdc"
 
-	"github.com/ethereum/go-ethereum/crypto"
-
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
-// Configuration constants; update these with your values.
-const (
+// Default contract addresses; update these with your values or select a network profile with --profile.
+var (
 	contractAddress     = "0x6b338b0ab70B08ABEf6F4344F8dB3Bd3e42591Cc" // Your deployed DeFiLending contract address
 	usdcContractAddress = "0xae624D2005c193aA546e29Ecc3346307A3dDfdD2"
 )
 
+// usage lists the available subcommands.
+const usage = "Expected 'deposit', 'total', 'market', 'apy', 'pnl', 'simulate', 'audit', 'user', 'keeper', 'exporter', 'serve', 'monitor', 'protect', 'admin', 'inspect', 'deploy', 'check', 'call', 'send', 'decode' or 'trace' subcommand"
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Expected 'deposit', 'total', or 'user' subcommand")
+	// Global flags apply to every read command and must precede the subcommand.
+	blockFlag := flag.String("block", "latest", "Block to read at: a number, a hash, 'latest', 'safe' or 'finalized'")
+	atFlag := flag.String("at", "", "Read at the last block mined at or before this time (RFC 3339 or unix seconds)")
+	profileFlag := flag.String("profile", os.Getenv("PROFILE"), "Network profile name or path whose addresses replace the defaults (default $PROFILE)")
+	flag.BoolVar(&forceWrites, "force", false, "Sign even if the chain ID or configured contracts fail the pre-flight checks")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 1 {
+		fmt.Println(usage)
 		os.Exit(1)
 	}
 
+	if *profileFlag != "" {
+		profile, err := loadProfile(profilePath(*profileFlag))
+		if err != nil {
+			log.Fatal("Failed to load profile:", err)
+		}
+		activeProfile = profile
+		contractAddress = profile.Lending.Hex()
+		usdcContractAddress = profile.Token.Hex()
+	}
+
 	rpcURL := os.Getenv("RPC_URL")
 	if rpcURL == "" {
 		log.Fatal("RPC_URL environment variable not set")
 	}
 
-	// Connect to Ethereum client.
-	client, err := ethclient.Dial(rpcURL)
+	// Connect to Ethereum client, through an endpoint pool when several endpoints are configured.
+	client, err := dialRPC(context.Background(), rpcURL)
 	if err != nil {
 		log.Fatal("Failed to connect to Ethereum client:", err)
 	}
@@ -55,17 +72,27 @@ func main() {
 		log.Fatal("Failed to load uSDC token contract:", err)
 	}
 
-	switch os.Args[1] {
+	// readOpts pins reads to the block selected by --block or --at.
+	readOpts := func() (*bind.CallOpts, *types.Header) {
+		header, err := resolveReadBlock(context.Background(), client, *blockFlag, *atFlag)
+		if err != nil {
+			log.Fatal("Failed to resolve read block:", err)
+		}
+		return &bind.CallOpts{BlockNumber: header.Number}, header
+	}
+
+	switch args[0] {
 
 	// Deposit subcommand: send a deposit transaction. Requires amount and private-key.
 	case "deposit":
 		depositCmd := flag.NewFlagSet("deposit", flag.ExitOnError)
 		amountFlag := depositCmd.String("amount", "", "Amount to deposit (e.g., '10' for 10 tokens)")
 		privateKeyFlag := depositCmd.String("private-key", "", "Private key for signing the transaction")
-		depositCmd.Parse(os.Args[2:])
+		depositCmd.BoolVar(&assumeYes, "yes", false, "Skip the confirmation prompts")
+		depositCmd.Parse(args[1:])
 
 		if *amountFlag == "" || *privateKeyFlag == "" {
-			fmt.Println("Usage: deposit --amount <amount> --private-key <private-key>")
+			fmt.Println("Usage: deposit --amount <amount> --private-key <private-key> [--yes]")
 			os.Exit(1)
 		}
 
@@ -79,16 +106,7 @@ func main() {
 		depositAmount := new(big.Int).Mul(amt, multiplier)
 
 		// Create an authorized transactor using the provided private key.
-		privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(*privateKeyFlag, "0x"))
-		if err != nil {
-			log.Fatal("Invalid private key:", err)
-		}
-
-		chainID, err := client.NetworkID(context.Background())
-		if err != nil {
-			log.Fatal("Failed to get chain ID:", err)
-		}
-		auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainID)
+		auth, err := newTransactor(client, *privateKeyFlag)
 		if err != nil {
 			log.Fatal("Failed to create transactor:", err)
 		}
@@ -131,31 +149,113 @@ func main() {
 
 	// Total subcommand: read the total deposits in the contract.
 	case "total":
-		total, err := lending.TotalDeposits(&bind.CallOpts{})
+		opts, _ := readOpts()
+		total, err := lending.TotalDeposits(opts)
 		if err != nil {
 			log.Fatal("Failed to get total deposits:", err)
 		}
 		fmt.Println("Total Deposits:", total)
 
+	// Market subcommand: report the full market state read at one block.
+	case "market":
+		_, header := readOpts()
+		runMarket(client, lending, usdcToken, header)
+
+	// APY subcommand: realized supply APY from historical DepositIndex values.
+	case "apy":
+		_, header := readOpts()
+		runAPY(client, lending, header, args[1:])
+
+	// PnL subcommand: per-period interest earned and paid by an account.
+	case "pnl":
+		_, header := readOpts()
+		runPnL(client, lending, header, args[1:])
+
+	// Simulate subcommand: project positions forward or try planned actions without sending transactions.
+	case "simulate":
+		_, header := readOpts()
+		runSimulate(client, lending, usdcToken, header, args[1:])
+
+	// Audit subcommand: verify the contract's accounting invariants.
+	case "audit":
+		_, header := readOpts()
+		runAudit(client, lending, usdcToken, header, args[1:])
+
 	// User subcommand: read the deposit amount for a specific user.
 	case "user":
 		userCmd := flag.NewFlagSet("user", flag.ExitOnError)
 		addressFlag := userCmd.String("address", "", "User address (e.g., 0x...)")
-		userCmd.Parse(os.Args[2:])
+		userCmd.Parse(args[1:])
 
 		if *addressFlag == "" {
 			fmt.Println("Please specify --address")
 			os.Exit(1)
 		}
 		userAddr := common.HexToAddress(*addressFlag)
-		userDeposit, err := lending.Deposits(&bind.CallOpts{}, userAddr)
+		opts, _ := readOpts()
+		userDeposit, err := lending.Deposits(opts, userAddr)
 		if err != nil {
 			log.Fatal("Failed to get deposit for user:", err)
 		}
 		fmt.Printf("Deposit for user %s: %s\n", userAddr.Hex(), userDeposit.String())
 
+	// Keeper subcommand: watch the market and liquidate unhealthy positions.
+	case "keeper":
+		runKeeper(client, lending, usdcToken, args[1:])
+
+	// Exporter subcommand: serve Prometheus metrics for the market and watched positions.
+	case "exporter":
+		runExporter(client, lending, usdcToken, args[1:])
+
+	// Serve subcommand: expose the market over a REST API.
+	case "serve":
+		runServe(client, lending, usdcToken, args[1:])
+
+	// Monitor subcommand: alert on unhealthy positions and sensitive contract events.
+	case "monitor":
+		runMonitor(client, lending, args[1:])
+
+	// Protect subcommand: repay or top up the signer's position before it can be liquidated.
+	case "protect":
+		runProtect(client, lending, usdcToken, args[1:])
+
+	// Admin subcommand: ownership operations on the lending contract.
+	case "admin":
+		runAdmin(client, lending, readOpts, args[1:])
+
+	// Inspect subcommand: read the proxy's ERC-1967 slots and upgrade history.
+	case "inspect":
+		_, header := readOpts()
+		runInspect(client, lending, header, args[1:])
+
+	// Deploy subcommand: deploy the token, implementation and proxy from compiled artifacts.
+	case "deploy":
+		runDeploy(client, args[1:])
+
+	// Check subcommand: compare the generated bindings with the artifacts and the deployed code.
+	case "check":
+		_, header := readOpts()
+		runCheck(client, header, args[1:])
+
+	// Call subcommand: call any ABI method and decode its return values.
+	case "call":
+		_, header := readOpts()
+		runCall(client, header, args[1:])
+
+	// Send subcommand: send a transaction to any ABI method and decode its events.
+	case "send":
+		runSend(client, args[1:])
+
+	// Decode subcommand: decode transactions, calldata and revert data against the lending and uSDC ABIs.
+	case "decode":
+		runDecode(client, lending, usdcToken, args[1:])
+
+	// Trace subcommand: show a transaction's call tree with gas per frame.
+	case "trace":
+		runTrace(client, args[1:])
+
 	default:
-		fmt.Println("Expected 'deposit', 'total', or 'user' subcommand")
+		fmt.Println(usage)
 		os.Exit(1)
 	}
 }
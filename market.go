@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"time"
+
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// indexScale is the fixed-point scale of DepositIndex; an index of 1e18 is a share price of 1.
+var indexScale = new(big.Float).SetFloat64(1e18)
+
+// market is a snapshot of the lending market's global state read at a single block.
+type market struct {
+	TotalDeposits      *big.Int
+	TotalBorrows       *big.Int
+	TotalDepositShares *big.Int
+	DepositIndex       *big.Int
+	InterestRate       *big.Int
+	Threshold          *big.Int       // LiquidationThreshold, in percent
+	Liquidity          *big.Int       // uSDC BalanceOf the lending contract
+	Token              common.Address // Token()
+	Owner              common.Address // Owner()
+}
+
+// loadMarket reads every market field using the same call options.
+func loadMarket(lending *defi.Defi, usdcToken *usdc.Usdc, opts *bind.CallOpts) (*market, error) {
+	m := &market{}
+	var err error
+	if m.TotalDeposits, err = lending.TotalDeposits(opts); err != nil {
+		return nil, err
+	}
+	if m.TotalBorrows, err = lending.TotalBorrows(opts); err != nil {
+		return nil, err
+	}
+	if m.TotalDepositShares, err = lending.TotalDepositShares(opts); err != nil {
+		return nil, err
+	}
+	if m.DepositIndex, err = lending.DepositIndex(opts); err != nil {
+		return nil, err
+	}
+	if m.InterestRate, err = lending.InterestRate(opts); err != nil {
+		return nil, err
+	}
+	if m.Threshold, err = lending.LiquidationThreshold(opts); err != nil {
+		return nil, err
+	}
+	if m.Liquidity, err = usdcToken.BalanceOf(opts, common.HexToAddress(contractAddress)); err != nil {
+		return nil, err
+	}
+	if m.Token, err = lending.Token(opts); err != nil {
+		return nil, err
+	}
+	if m.Owner, err = lending.Owner(opts); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Utilization returns TotalBorrows divided by TotalDeposits.
+func (m *market) Utilization() *big.Float {
+	return ratio(m.TotalBorrows, m.TotalDeposits)
+}
+
+// APR returns InterestRate as a fraction, reading it as an annual simple rate in percent.
+func (m *market) APR() float64 {
+	rate, _ := new(big.Float).SetInt(m.InterestRate).Float64()
+	return rate / 100
+}
+
+// SharePrice returns DepositIndex as the value of one deposit share.
+func (m *market) SharePrice() *big.Float {
+	return new(big.Float).Quo(new(big.Float).SetInt(m.DepositIndex), indexScale)
+}
+
+// aprToAPY converts an annual rate to its daily-compounded yield.
+func aprToAPY(apr float64) float64 {
+	return math.Pow(1+apr/365, 365) - 1
+}
+
+// runMarket implements the market subcommand, reading at the given block.
+func runMarket(client *ethclient.Client, lending *defi.Defi, usdcToken *usdc.Usdc, head *types.Header) {
+	opts := &bind.CallOpts{Context: context.Background(), BlockNumber: head.Number}
+	m, err := loadMarket(lending, usdcToken, opts)
+	if err != nil {
+		log.Fatal("Failed to read market:", err)
+	}
+
+	fmt.Printf("Block:                 %s (%s)\n", head.Number, time.Unix(int64(head.Time), 0).UTC().Format(time.RFC3339))
+	fmt.Println("Token:                ", m.Token.Hex())
+	fmt.Println("Owner:                ", m.Owner.Hex())
+	fmt.Println("Total deposits:       ", formatToken(m.TotalDeposits))
+	fmt.Println("Total borrows:        ", formatToken(m.TotalBorrows))
+	fmt.Println("Available liquidity:  ", formatToken(m.Liquidity))
+	fmt.Printf("Utilization:           %s%%\n", new(big.Float).Mul(m.Utilization(), big.NewFloat(100)).Text('f', 2))
+	fmt.Printf("Borrow rate:           %.2f%% APR / %.2f%% APY (raw %s)\n", m.APR()*100, aprToAPY(m.APR())*100, m.InterestRate)
+	fmt.Printf("Liquidation threshold: %s%%\n", m.Threshold)
+	fmt.Printf("Share price:           %s (index %s)\n", m.SharePrice().Text('f', 6), m.DepositIndex)
+	fmt.Println("Total deposit shares: ", m.TotalDepositShares)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"defi-lending/defi"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// alert is a single notification produced by the monitor.
+type alert struct {
+	Key      string // de-duplication key; alerts with the same key respect the cooldown
+	Severity string
+	Message  string
+}
+
+// notifier delivers alerts to one destination.
+type notifier interface {
+	Notify(a alert) error
+}
+
+// webhookNotifier posts Slack-compatible JSON to a URL.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(a alert) error {
+	body, err := json.Marshal(map[string]string{
+		"text":     fmt.Sprintf("[%s] %s", strings.ToUpper(a.Severity), a.Message),
+		"severity": a.Severity,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// smtpNotifier sends alerts by email.
+type smtpNotifier struct {
+	addr string
+	from string
+	to   []string
+	auth smtp.Auth
+}
+
+func (n *smtpNotifier) Notify(a alert) error {
+	subject := fmt.Sprintf("[DeFiLending %s] %s", strings.ToUpper(a.Severity), a.Key)
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", n.from, strings.Join(n.to, ", "), subject, a.Message)
+	return smtp.SendMail(n.addr, n.auth, n.from, n.to, []byte(msg))
+}
+
+// monitor tracks watched positions and lending contract events and raises alerts.
+type monitor struct {
+	client        *ethclient.Client
+	lending       *defi.Defi
+	watched       map[common.Address]bool
+	warning       *big.Float
+	critical      *big.Float
+	interestLimit *big.Int
+	cooldown      time.Duration
+	notifiers     []notifier
+	lastSent      map[string]time.Time
+	batch         *batcher
+}
+
+// runMonitor implements the monitor subcommand.
+func runMonitor(client *ethclient.Client, lending *defi.Defi, args []string) {
+	monitorCmd := flag.NewFlagSet("monitor", flag.ExitOnError)
+	watchFlag := monitorCmd.String("watch", "", "Comma-separated addresses to monitor")
+	warningFlag := monitorCmd.Float64("warning", 1.2, "Health factor below which a warning is sent")
+	criticalFlag := monitorCmd.Float64("critical", 1.05, "Health factor below which a critical alert is sent")
+	interestFlag := monitorCmd.String("interest-limit", "", "Alert when VerifyInterest exceeds this many whole tokens")
+	cooldownFlag := monitorCmd.Duration("cooldown", time.Hour, "Minimum time between repeated alerts for the same condition")
+	intervalFlag := monitorCmd.Duration("interval", 12*time.Second, "How often to poll for new blocks")
+	webhookFlag := monitorCmd.String("webhook", "", "Comma-separated webhook URLs (Slack-compatible JSON)")
+	smtpAddrFlag := monitorCmd.String("smtp-addr", "", "SMTP server host:port; credentials are read from SMTP_USERNAME and SMTP_PASSWORD")
+	smtpFromFlag := monitorCmd.String("smtp-from", "", "Sender address for email alerts")
+	smtpToFlag := monitorCmd.String("smtp-to", "", "Comma-separated recipients for email alerts")
+	monitorCmd.Parse(args)
+
+	watched, err := parseAddressList(*watchFlag)
+	if err != nil {
+		log.Fatal("Invalid --watch list:", err)
+	}
+	if len(watched) == 0 {
+		fmt.Println("Usage: monitor --watch <address,...> [--webhook <url,...>] [--smtp-addr <host:port> --smtp-from <addr> --smtp-to <addr,...>]")
+		os.Exit(1)
+	}
+	m := &monitor{
+		client:   client,
+		lending:  lending,
+		watched:  map[common.Address]bool{},
+		warning:  big.NewFloat(*warningFlag),
+		critical: big.NewFloat(*criticalFlag),
+		cooldown: *cooldownFlag,
+		lastSent: map[string]time.Time{},
+		batch:    newBatcher(client),
+	}
+	for _, addr := range watched {
+		m.watched[addr] = true
+	}
+	if *interestFlag != "" {
+		if m.interestLimit, err = parseToken(*interestFlag); err != nil {
+			log.Fatal("Invalid --interest-limit:", err)
+		}
+	}
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	for _, url := range strings.Split(*webhookFlag, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			m.notifiers = append(m.notifiers, &webhookNotifier{url: url, client: httpClient})
+		}
+	}
+	if *smtpAddrFlag != "" {
+		host, _, err := net.SplitHostPort(*smtpAddrFlag)
+		if err != nil {
+			log.Fatal("Invalid --smtp-addr:", err)
+		}
+		n := &smtpNotifier{addr: *smtpAddrFlag, from: *smtpFromFlag}
+		for _, to := range strings.Split(*smtpToFlag, ",") {
+			if to = strings.TrimSpace(to); to != "" {
+				n.to = append(n.to, to)
+			}
+		}
+		if n.from == "" || len(n.to) == 0 {
+			log.Fatal("--smtp-from and --smtp-to are required with --smtp-addr")
+		}
+		if user := os.Getenv("SMTP_USERNAME"); user != "" {
+			n.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		m.notifiers = append(m.notifiers, n)
+	}
+	if len(m.notifiers) == 0 {
+		fmt.Println("No notifiers configured; alerts are only printed")
+	}
+
+	ctx := context.Background()
+	last, err := client.BlockNumber(ctx)
+	if err != nil {
+		log.Fatal("Failed to get latest block:", err)
+	}
+	fmt.Printf("Monitoring %d addresses from block %d\n", len(watched), last)
+	m.checkPositions(ctx, last)
+
+	ticker := time.NewTicker(*intervalFlag)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.pruneSent()
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			log.Println("Failed to get latest block:", err)
+			continue
+		}
+		if head <= last {
+			continue
+		}
+		// Check events in maxLogRange chunks, advancing past each one, so catching up after an outage makes progress.
+		for last < head {
+			end := min(last+maxLogRange, head)
+			if err := m.checkEvents(ctx, last+1, end); err != nil {
+				log.Println("Failed to check lending events:", err)
+				break
+			}
+			last = end
+		}
+		if last < head {
+			continue
+		}
+		m.checkPositions(ctx, head)
+	}
+}
+
+// checkPositions raises health factor and interest alerts for every watched address.
+func (m *monitor) checkPositions(ctx context.Context, block uint64) {
+	addrs := m.watchedList()
+	positions, errs, err := loadPositions(ctx, m.batch, addrs, new(big.Int).SetUint64(block))
+	if err != nil {
+		log.Println("Failed to read positions:", err)
+		return
+	}
+	for i, addr := range addrs {
+		pos := positions[i]
+		if errs[i] != nil {
+			log.Printf("Failed to read position of %s: %v", addr.Hex(), errs[i])
+			continue
+		}
+		hf := pos.HealthFactor()
+		switch {
+		case hf != nil && hf.Cmp(m.critical) < 0:
+			m.send(alert{
+				Key:      "health-critical:" + addr.Hex(),
+				Severity: "critical",
+				Message:  fmt.Sprintf("Health factor of %s is %s (critical below %s) at block %d; debt %s, deposit %s", addr.Hex(), formatHealth(hf), m.critical.Text('f', 2), block, formatToken(pos.Debt()), formatToken(pos.Deposit)),
+			})
+		case hf != nil && hf.Cmp(m.warning) < 0:
+			m.send(alert{
+				Key:      "health-warning:" + addr.Hex(),
+				Severity: "warning",
+				Message:  fmt.Sprintf("Health factor of %s is %s (warning below %s) at block %d; debt %s, deposit %s", addr.Hex(), formatHealth(hf), m.warning.Text('f', 2), block, formatToken(pos.Debt()), formatToken(pos.Deposit)),
+			})
+		default:
+			// Reset the cooldowns so a new drop alerts immediately.
+			delete(m.lastSent, "health-critical:"+addr.Hex())
+			delete(m.lastSent, "health-warning:"+addr.Hex())
+		}
+		if m.interestLimit != nil && pos.Interest.Cmp(m.interestLimit) > 0 {
+			m.send(alert{
+				Key:      "interest:" + addr.Hex(),
+				Severity: "warning",
+				Message:  fmt.Sprintf("Accrued interest of %s is %s, above the limit of %s", addr.Hex(), formatToken(pos.Interest), formatToken(m.interestLimit)),
+			})
+		}
+	}
+}
+
+// checkEvents raises alerts for liquidations of watched addresses, upgrades and ownership changes.
+// The range must be at most maxLogRange blocks.
+func (m *monitor) checkEvents(ctx context.Context, from, to uint64) error {
+	opts := &bind.FilterOpts{Start: from, End: &to, Context: ctx}
+
+	liquidated, err := m.lending.FilterLiquidated(opts, m.watchedList())
+	if err != nil {
+		return err
+	}
+	for liquidated.Next() {
+		evt := liquidated.Event
+		m.send(alert{
+			Key:      eventKey("liquidated", evt.Raw.TxHash, evt.Raw.Index),
+			Severity: "critical",
+			Message:  fmt.Sprintf("%s was liquidated in tx %s (block %d); collateral seized %s", evt.User.Hex(), evt.Raw.TxHash.Hex(), evt.Raw.BlockNumber, formatToken(evt.CollateralSeized)),
+		})
+	}
+	err = liquidated.Error()
+	liquidated.Close()
+	if err != nil {
+		return err
+	}
+
+	upgraded, err := m.lending.FilterUpgraded(opts, nil)
+	if err != nil {
+		return err
+	}
+	for upgraded.Next() {
+		evt := upgraded.Event
+		m.send(alert{
+			Key:      eventKey("upgraded", evt.Raw.TxHash, evt.Raw.Index),
+			Severity: "critical",
+			Message:  fmt.Sprintf("Lending contract upgraded to implementation %s in tx %s (block %d)", evt.Implementation.Hex(), evt.Raw.TxHash.Hex(), evt.Raw.BlockNumber),
+		})
+	}
+	err = upgraded.Error()
+	upgraded.Close()
+	if err != nil {
+		return err
+	}
+
+	transferred, err := m.lending.FilterOwnershipTransferred(opts, nil, nil)
+	if err != nil {
+		return err
+	}
+	for transferred.Next() {
+		evt := transferred.Event
+		m.send(alert{
+			Key:      eventKey("ownership", evt.Raw.TxHash, evt.Raw.Index),
+			Severity: "critical",
+			Message:  fmt.Sprintf("Lending contract ownership transferred from %s to %s in tx %s (block %d)", evt.PreviousOwner.Hex(), evt.NewOwner.Hex(), evt.Raw.TxHash.Hex(), evt.Raw.BlockNumber),
+		})
+	}
+	err = transferred.Error()
+	transferred.Close()
+	return err
+}
+
+// send delivers an alert to every notifier unless the same key was sent within the cooldown.
+func (m *monitor) send(a alert) {
+	if last, ok := m.lastSent[a.Key]; ok && time.Since(last) < m.cooldown {
+		return
+	}
+	m.lastSent[a.Key] = time.Now()
+	fmt.Printf("[%s] %s\n", strings.ToUpper(a.Severity), a.Message)
+	for _, n := range m.notifiers {
+		if err := n.Notify(a); err != nil {
+			log.Println("Failed to deliver alert:", err)
+		}
+	}
+}
+
+// pruneSent forgets alerts sent longer ago than the cooldown, which would be sent again anyway, so per-event
+// keys do not accumulate for the lifetime of the monitor. Events are only re-read when a failed chunk is
+// retried on the next tick, well within the cooldown.
+func (m *monitor) pruneSent() {
+	for key, sent := range m.lastSent {
+		if time.Since(sent) >= m.cooldown {
+			delete(m.lastSent, key)
+		}
+	}
+}
+
+// watchedList returns the watched addresses as a filter argument.
+func (m *monitor) watchedList() []common.Address {
+	out := make([]common.Address, 0, len(m.watched))
+	for addr := range m.watched {
+		out = append(out, addr)
+	}
+	return out
+}
+
+// eventKey identifies a single log so it is never alerted twice.
+func eventKey(kind string, tx common.Hash, index uint) string {
+	return fmt.Sprintf("%s:%s:%d", kind, tx.Hex(), index)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// multicall3Address is where Multicall3 is deployed on most EVM chains.
+var multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// multicall3ABI is the aggregate3 function of Multicall3.
+const multicall3ABI = `[{"type":"function","name":"aggregate3","stateMutability":"payable",
+"inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],
+"outputs":[{"name":"returnData","type":"tuple[]","components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}]}]`
+
+// defaultBatchSize is the number of calls sent per aggregate3 call or JSON-RPC batch request.
+const defaultBatchSize = 200
+
+// multicallCall and multicallResult mirror Multicall3's Call3 and Result structs.
+type multicallCall struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicallResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// batchCall is one contract read in a batch. Values or Err is set once the batch has run.
+type batchCall struct {
+	Target common.Address
+	ABI    *abi.ABI
+	Method string
+	Args   []interface{}
+
+	Values []interface{}
+	Err    error
+}
+
+// batcher runs many reads in a few round trips, all pinned to the same block: through Multicall3 when it is
+// deployed, otherwise as JSON-RPC batch requests.
+type batcher struct {
+	client    *ethclient.Client
+	multicall abi.ABI
+	size      int
+	available *bool // whether Multicall3 is deployed, checked on first use
+}
+
+// newBatcher creates a batcher sending defaultBatchSize calls per round trip.
+func newBatcher(client *ethclient.Client) *batcher {
+	parsed, err := abi.JSON(strings.NewReader(multicall3ABI))
+	if err != nil {
+		panic(err)
+	}
+	return &batcher{client: client, multicall: parsed, size: defaultBatchSize}
+}
+
+// call runs every call at block, which must be a concrete block number so all reads see the same state.
+// Failures of individual calls are recorded in their Err; the returned error is a transport failure.
+func (b *batcher) call(ctx context.Context, block *big.Int, calls []*batchCall) error {
+	if block == nil {
+		return fmt.Errorf("batched reads must be pinned to a block")
+	}
+	data := make([][]byte, len(calls))
+	for i, c := range calls {
+		var err error
+		if data[i], err = c.ABI.Pack(c.Method, c.Args...); err != nil {
+			return fmt.Errorf("pack %s: %w", c.Method, err)
+		}
+	}
+	if b.available == nil {
+		code, err := b.client.CodeAt(ctx, multicall3Address, block)
+		if err != nil {
+			return err
+		}
+		available := len(code) > 0
+		b.available = &available
+	}
+	for start := 0; start < len(calls); start += b.size {
+		end := min(start+b.size, len(calls))
+		var results [][]byte
+		var errs []error
+		var err error
+		if *b.available {
+			results, errs, err = b.aggregate3(ctx, block, calls[start:end], data[start:end])
+		} else {
+			results, errs, err = b.rpcBatch(ctx, block, calls[start:end], data[start:end])
+		}
+		if err != nil {
+			return err
+		}
+		for i, c := range calls[start:end] {
+			if c.Err = errs[i]; c.Err != nil {
+				continue
+			}
+			if c.Values, c.Err = c.ABI.Unpack(c.Method, results[i]); c.Err != nil {
+				c.Err = fmt.Errorf("unpack %s: %w", c.Method, c.Err)
+			}
+		}
+	}
+	return nil
+}
+
+// aggregate3 sends a chunk of calls as a single Multicall3 eth_call, allowing individual calls to fail.
+func (b *batcher) aggregate3(ctx context.Context, block *big.Int, calls []*batchCall, data [][]byte) ([][]byte, []error, error) {
+	input := make([]multicallCall, len(calls))
+	for i, c := range calls {
+		input[i] = multicallCall{Target: c.Target, AllowFailure: true, CallData: data[i]}
+	}
+	packed, err := b.multicall.Pack("aggregate3", input)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := b.client.CallContract(ctx, ethereum.CallMsg{To: &multicall3Address, Data: packed}, block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("aggregate3: %w", err)
+	}
+	out, err := b.multicall.Unpack("aggregate3", raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("aggregate3: %w", err)
+	}
+	decoded := *abi.ConvertType(out[0], new([]multicallResult)).(*[]multicallResult)
+	if len(decoded) != len(calls) {
+		return nil, nil, fmt.Errorf("aggregate3 returned %d results for %d calls", len(decoded), len(calls))
+	}
+	results, errs := make([][]byte, len(calls)), make([]error, len(calls))
+	for i, r := range decoded {
+		if r.Success {
+			results[i] = r.ReturnData
+		} else {
+			errs[i] = fmt.Errorf("%s reverted: %s", calls[i].Method, decodeRevert(r.ReturnData))
+		}
+	}
+	return results, errs, nil
+}
+
+// rpcBatch sends a chunk of calls as one JSON-RPC batch of eth_call requests.
+func (b *batcher) rpcBatch(ctx context.Context, block *big.Int, calls []*batchCall, data [][]byte) ([][]byte, []error, error) {
+	elems := make([]rpc.BatchElem, len(calls))
+	outputs := make([]hexutil.Bytes, len(calls))
+	for i, c := range calls {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args:   []interface{}{map[string]interface{}{"to": c.Target, "data": hexutil.Bytes(data[i])}, hexutil.EncodeBig(block)},
+			Result: &outputs[i],
+		}
+	}
+	if err := b.client.Client().BatchCallContext(ctx, elems); err != nil {
+		return nil, nil, fmt.Errorf("eth_call batch: %w", err)
+	}
+	results, errs := make([][]byte, len(calls)), make([]error, len(calls))
+	for i, e := range elems {
+		if e.Error != nil {
+			errs[i] = fmt.Errorf("%s: %w", calls[i].Method, e.Error)
+			continue
+		}
+		results[i] = outputs[i]
+	}
+	return results, errs, nil
+}
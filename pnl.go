@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"defi-lending/defi"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ledgerEntry is one lending event of an account.
+type ledgerEntry struct {
+	Block     uint64
+	Index     uint
+	Time      uint64
+	Kind      string   // deposit, withdraw, borrow, repay or liquidate
+	Amount    *big.Int // tokens moved, or the collateral seized by a liquidation
+	Shares    *big.Int // shares minted or burned, for deposits, withdrawals and liquidations
+	Principal *big.Int // principal after the event, for borrows, repayments and liquidations
+	Interest  *big.Int // interest capitalized or settled, for borrows, repayments and liquidations
+}
+
+// ledgerOpening is an account's position just before the first block of its ledger.
+type ledgerOpening struct {
+	Shares    *big.Int
+	Principal *big.Int
+}
+
+// pnlPeriod aggregates an account's activity over one reporting period.
+type pnlPeriod struct {
+	Start, End     time.Time
+	Deposited      *big.Int
+	Withdrawn      *big.Int
+	Borrowed       *big.Int
+	Repaid         *big.Int
+	Seized         *big.Int // collateral seized by liquidations
+	InterestEarned *big.Int
+	InterestPaid   *big.Int
+}
+
+// NetPnL returns interest earned minus interest paid.
+func (p *pnlPeriod) NetPnL() *big.Int {
+	return new(big.Int).Sub(p.InterestEarned, p.InterestPaid)
+}
+
+// loadLedger reads every Deposited, Withdrawn, Borrowed, Repaid and Liquidated event of an account, in chain
+// order, and the position it had before from. Liquidations and the opening position are read from an archive node.
+func loadLedger(ctx context.Context, client *ethclient.Client, lending *defi.Defi, user common.Address, from, to uint64) ([]*ledgerEntry, *ledgerOpening, error) {
+	opening := &ledgerOpening{Shares: new(big.Int), Principal: new(big.Int)}
+	if from > 0 {
+		pos, err := loadPosition(lending, &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(from - 1)}, user)
+		if err != nil {
+			return nil, nil, fmt.Errorf("position before block %d: %w", from, err)
+		}
+		opening.Shares, opening.Principal = pos.Shares, pos.Principal
+	}
+
+	var entries []*ledgerEntry
+	users := []common.Address{user}
+	for start := from; start <= to; start += maxLogRange {
+		end := min(start+maxLogRange-1, to)
+		opts := &bind.FilterOpts{Start: start, End: &end, Context: ctx}
+
+		deposited, err := lending.FilterDeposited(opts, users)
+		if err != nil {
+			return nil, nil, err
+		}
+		for deposited.Next() {
+			e := deposited.Event
+			entries = append(entries, &ledgerEntry{Block: e.Raw.BlockNumber, Index: e.Raw.Index, Kind: "deposit", Amount: e.Amount, Shares: e.Shares})
+		}
+		err = deposited.Error()
+		deposited.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		withdrawn, err := lending.FilterWithdrawn(opts, users)
+		if err != nil {
+			return nil, nil, err
+		}
+		for withdrawn.Next() {
+			e := withdrawn.Event
+			entries = append(entries, &ledgerEntry{Block: e.Raw.BlockNumber, Index: e.Raw.Index, Kind: "withdraw", Amount: e.Amount, Shares: e.Shares})
+		}
+		err = withdrawn.Error()
+		withdrawn.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		borrowed, err := lending.FilterBorrowed(opts, users)
+		if err != nil {
+			return nil, nil, err
+		}
+		for borrowed.Next() {
+			e := borrowed.Event
+			entries = append(entries, &ledgerEntry{Block: e.Raw.BlockNumber, Index: e.Raw.Index, Kind: "borrow", Amount: e.Amount, Principal: e.NewPrincipal})
+		}
+		err = borrowed.Error()
+		borrowed.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		repaid, err := lending.FilterRepaid(opts, users)
+		if err != nil {
+			return nil, nil, err
+		}
+		for repaid.Next() {
+			e := repaid.Event
+			entries = append(entries, &ledgerEntry{Block: e.Raw.BlockNumber, Index: e.Raw.Index, Kind: "repay", Amount: e.Amount, Principal: e.RemainingPrincipal})
+		}
+		err = repaid.Error()
+		repaid.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		liquidated, err := lending.FilterLiquidated(opts, users)
+		if err != nil {
+			return nil, nil, err
+		}
+		for liquidated.Next() {
+			e := liquidated.Event
+			entries = append(entries, &ledgerEntry{Block: e.Raw.BlockNumber, Index: e.Raw.Index, Kind: "liquidate", Amount: e.CollateralSeized})
+		}
+		err = liquidated.Error()
+		liquidated.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Block != entries[j].Block {
+			return entries[i].Block < entries[j].Block
+		}
+		return entries[i].Index < entries[j].Index
+	})
+
+	headers := map[uint64]*types.Header{}
+	for _, e := range entries {
+		if e.Kind == "liquidate" {
+			// The event only reports the collateral, so the shares burned, the interest settled and the principal
+			// left are read around the block; other activity of the account in the same block is attributed to it.
+			before, err := loadPosition(lending, &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(e.Block - 1)}, user)
+			if err != nil {
+				return nil, nil, fmt.Errorf("position before liquidation in block %d: %w", e.Block, err)
+			}
+			after, err := loadPosition(lending, &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(e.Block)}, user)
+			if err != nil {
+				return nil, nil, fmt.Errorf("position after liquidation in block %d: %w", e.Block, err)
+			}
+			e.Shares = new(big.Int).Sub(before.Shares, after.Shares)
+			if e.Shares.Sign() < 0 {
+				e.Shares.SetInt64(0)
+			}
+			e.Principal, e.Interest = after.Principal, before.Interest
+		}
+		h, ok := headers[e.Block]
+		if !ok {
+			var err error
+			if h, err = headerAt(ctx, client, e.Block); err != nil {
+				return nil, nil, err
+			}
+			headers[e.Block] = h
+		}
+		e.Time = h.Time
+	}
+	ledgerInterest(entries, opening.Principal)
+	return entries, opening, nil
+}
+
+// ledgerInterest sets the interest of borrows and repayments in chain-ordered entries, starting from principal.
+// Interest accrued between two borrow-side events is capitalized into the principal they report:
+// a borrow yields prev+interest+amount, a repayment prev+interest-amount. A liquidation resets the principal.
+func ledgerInterest(entries []*ledgerEntry, principal *big.Int) {
+	principal = new(big.Int).Set(principal)
+	for _, e := range entries {
+		switch e.Kind {
+		case "borrow", "repay":
+			interest := new(big.Int).Sub(e.Principal, principal)
+			if e.Kind == "borrow" {
+				interest.Sub(interest, e.Amount)
+			} else {
+				interest.Add(interest, e.Amount)
+			}
+			if interest.Sign() < 0 {
+				interest.SetInt64(0)
+			}
+			e.Interest, principal = interest, e.Principal
+		case "liquidate":
+			principal = e.Principal
+		}
+	}
+}
+
+// periodStart truncates a time to the start of its day, ISO week or month in UTC.
+func periodStart(t time.Time, period string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextPeriod returns the start of the period after the one starting at t.
+func nextPeriod(t time.Time, period string) time.Time {
+	switch period {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// runPnL implements the pnl subcommand, treating head as the current block.
+func runPnL(client *ethclient.Client, lending *defi.Defi, head *types.Header, args []string) {
+	pnlCmd := flag.NewFlagSet("pnl", flag.ExitOnError)
+	addressFlag := pnlCmd.String("address", "", "Account to report on (e.g., 0x...)")
+	periodFlag := pnlCmd.String("period", "month", "Reporting period: 'day', 'week' or 'month'")
+	sourceFlag := pnlCmd.String("source", "archive", "Where to read the deposit index at period boundaries: 'archive' or 'events'")
+	fromFlag := pnlCmd.Uint64("from-block", 0, "First block to read events from (default: block of the first Initialized event)")
+	csvFlag := pnlCmd.Bool("csv", false, "Print the report as CSV")
+	pnlCmd.Parse(args)
+
+	if !common.IsHexAddress(*addressFlag) {
+		fmt.Println("Usage: pnl --address <address> [--period day|week|month] [--source archive|events] [--csv]")
+		os.Exit(1)
+	}
+	if *periodFlag != "day" && *periodFlag != "week" && *periodFlag != "month" {
+		log.Fatal("--period must be 'day', 'week' or 'month'")
+	}
+	if *sourceFlag != "archive" && *sourceFlag != "events" {
+		log.Fatal("--source must be 'archive' or 'events'")
+	}
+	user := common.HexToAddress(*addressFlag)
+	ctx := context.Background()
+	var err error
+	from := *fromFlag
+	if from == 0 {
+		if from, err = inceptionBlock(ctx, client, lending, head.Number.Uint64()); err != nil {
+			log.Fatal("Failed to find the Initialized event, pass --from-block:", err)
+		}
+	}
+
+	entries, opening, err := loadLedger(ctx, client, lending, user, from, head.Number.Uint64())
+	if err != nil {
+		log.Fatal("Failed to read account events:", err)
+	}
+	held := opening.Shares.Sign() > 0 || opening.Principal.Sign() > 0
+	if len(entries) == 0 && !held {
+		fmt.Println("No lending activity for", user.Hex())
+		return
+	}
+	var source indexSource = &archiveIndexSource{lending: lending}
+	if *sourceFlag == "events" {
+		if source, err = newEventIndexSource(ctx, client, lending, from, head.Number.Uint64()); err != nil {
+			log.Fatal("Failed to index deposit events:", err)
+		}
+	}
+	// shareValue values shares at the end of a period, using the head for the current period.
+	shareValue := func(shares *big.Int, at time.Time) (*big.Int, error) {
+		if shares.Sign() == 0 {
+			return new(big.Int), nil
+		}
+		header := head
+		if uint64(at.Unix()) < head.Time {
+			h, err := blockAtTime(ctx, client, uint64(at.Unix())-1)
+			if err != nil {
+				return nil, err
+			}
+			header = h
+		}
+		sample, err := source.IndexAt(ctx, header)
+		if err != nil {
+			return nil, err
+		}
+		v := new(big.Float).Mul(new(big.Float).SetInt(shares), sample.Index)
+		out, _ := v.Quo(v, indexScale).Int(nil)
+		return out, nil
+	}
+
+	// Outstanding interest not yet capitalized is charged to the current period.
+	current, err := loadPosition(lending, &bind.CallOpts{Context: ctx, BlockNumber: head.Number}, user)
+	if err != nil {
+		log.Fatal("Failed to read current position:", err)
+	}
+
+	var periods []*pnlPeriod
+	i := 0
+	now := time.Unix(int64(head.Time), 0).UTC()
+	// A position held before from is reported from the from block, with its shares valued there, so the
+	// interest they earn before the first event is counted.
+	shares := new(big.Int).Set(opening.Shares)
+	valueStart := new(big.Int)
+	var first time.Time
+	if held {
+		fromHeader, err := headerAt(ctx, client, from)
+		if err != nil {
+			log.Fatal("Failed to read the --from-block header:", err)
+		}
+		first = periodStart(time.Unix(int64(fromHeader.Time), 0), *periodFlag)
+		// The opening position already needs an archive node, and an events index starting at from has no sample
+		// for it yet.
+		if shares.Sign() > 0 {
+			archive := &archiveIndexSource{lending: lending}
+			sample, err := archive.IndexAt(ctx, fromHeader)
+			if err != nil {
+				log.Fatalf("Failed to value the opening shares at block %d: %v", from, err)
+			}
+			v := new(big.Float).Mul(new(big.Float).SetInt(shares), sample.Index)
+			valueStart, _ = v.Quo(v, indexScale).Int(nil)
+		}
+	} else {
+		first = periodStart(time.Unix(int64(entries[0].Time), 0), *periodFlag)
+	}
+	for start := first; !start.After(now); start = nextPeriod(start, *periodFlag) {
+		p := &pnlPeriod{
+			Start: start, End: nextPeriod(start, *periodFlag),
+			Deposited: new(big.Int), Withdrawn: new(big.Int), Borrowed: new(big.Int), Repaid: new(big.Int), Seized: new(big.Int),
+			InterestEarned: new(big.Int), InterestPaid: new(big.Int),
+		}
+		for ; i < len(entries) && time.Unix(int64(entries[i].Time), 0).Before(p.End); i++ {
+			e := entries[i]
+			switch e.Kind {
+			case "deposit":
+				p.Deposited.Add(p.Deposited, e.Amount)
+				shares.Add(shares, e.Shares)
+			case "withdraw":
+				p.Withdrawn.Add(p.Withdrawn, e.Amount)
+				shares.Sub(shares, e.Shares)
+			case "borrow":
+				p.Borrowed.Add(p.Borrowed, e.Amount)
+				p.InterestPaid.Add(p.InterestPaid, e.Interest)
+			case "repay":
+				p.Repaid.Add(p.Repaid, e.Amount)
+				p.InterestPaid.Add(p.InterestPaid, e.Interest)
+			case "liquidate":
+				p.Seized.Add(p.Seized, e.Amount)
+				shares.Sub(shares, e.Shares)
+				p.InterestPaid.Add(p.InterestPaid, e.Interest)
+			}
+		}
+		valueEnd, err := shareValue(shares, p.End)
+		if err != nil {
+			log.Fatalf("Failed to value shares at %s: %v", p.End.Format(time.RFC3339), err)
+		}
+		// Earned = growth in share value not explained by deposits, withdrawals and seized collateral.
+		p.InterestEarned.Sub(valueEnd, valueStart)
+		p.InterestEarned.Sub(p.InterestEarned, p.Deposited)
+		p.InterestEarned.Add(p.InterestEarned, p.Withdrawn)
+		p.InterestEarned.Add(p.InterestEarned, p.Seized)
+		valueStart = valueEnd
+		periods = append(periods, p)
+	}
+	last := periods[len(periods)-1]
+	last.InterestPaid.Add(last.InterestPaid, current.Interest)
+
+	header := []string{"period_start", "deposited", "withdrawn", "borrowed", "repaid", "seized", "interest_earned", "interest_paid", "net_pnl"}
+	rows := make([][]string, 0, len(periods)+1)
+	total := &pnlPeriod{Deposited: new(big.Int), Withdrawn: new(big.Int), Borrowed: new(big.Int), Repaid: new(big.Int), Seized: new(big.Int), InterestEarned: new(big.Int), InterestPaid: new(big.Int)}
+	for _, p := range periods {
+		rows = append(rows, []string{
+			p.Start.Format("2006-01-02"), formatToken(p.Deposited), formatToken(p.Withdrawn), formatToken(p.Borrowed),
+			formatToken(p.Repaid), formatToken(p.Seized), formatToken(p.InterestEarned), formatToken(p.InterestPaid), formatToken(p.NetPnL()),
+		})
+		total.Deposited.Add(total.Deposited, p.Deposited)
+		total.Withdrawn.Add(total.Withdrawn, p.Withdrawn)
+		total.Borrowed.Add(total.Borrowed, p.Borrowed)
+		total.Repaid.Add(total.Repaid, p.Repaid)
+		total.Seized.Add(total.Seized, p.Seized)
+		total.InterestEarned.Add(total.InterestEarned, p.InterestEarned)
+		total.InterestPaid.Add(total.InterestPaid, p.InterestPaid)
+	}
+	rows = append(rows, []string{
+		"total", formatToken(total.Deposited), formatToken(total.Withdrawn), formatToken(total.Borrowed),
+		formatToken(total.Repaid), formatToken(total.Seized), formatToken(total.InterestEarned), formatToken(total.InterestPaid), formatToken(total.NetPnL()),
+	})
+
+	if *csvFlag {
+		w := csv.NewWriter(os.Stdout)
+		w.Write(header)
+		w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			log.Fatal("Failed to write CSV:", err)
+		}
+		return
+	}
+	fmt.Printf("P&L for %s (%d events, amounts in uSDC)\n", user.Hex(), len(entries))
+	fmt.Printf("%-12s %14s %14s %14s %14s %14s %16s %14s %14s\n", header[0], header[1], header[2], header[3], header[4], header[5], header[6], header[7], header[8])
+	for _, r := range rows {
+		fmt.Printf("%-12s %14s %14s %14s %14s %14s %16s %14s %14s\n", r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7], r[8])
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestLedgerInterest(t *testing.T) {
+	entry := func(kind string, amount, principal int64) *ledgerEntry {
+		return &ledgerEntry{Kind: kind, Amount: big.NewInt(amount), Principal: big.NewInt(principal)}
+	}
+	liquidation := entry("liquidate", 500, 40)
+	liquidation.Interest = big.NewInt(3)
+	entries := []*ledgerEntry{
+		{Kind: "deposit", Amount: big.NewInt(1000), Shares: big.NewInt(1000)},
+		entry("borrow", 100, 110), // 10 accrued since the opening principal
+		entry("borrow", 50, 165),
+		entry("repay", 60, 107),
+		liquidation,
+		entry("repay", 10, 31),
+		entry("repay", 30, 0), // rounding left the reported principal below prev-amount
+	}
+	ledgerInterest(entries, big.NewInt(0))
+
+	want := []int64{-1, 10, 5, 2, 3, 1, 0} // -1: no interest for the entry
+	for i, e := range entries {
+		switch {
+		case want[i] < 0 && e.Interest != nil:
+			t.Errorf("entry %d (%s): interest = %s, want none", i, e.Kind, e.Interest)
+		case want[i] >= 0 && (e.Interest == nil || e.Interest.Cmp(big.NewInt(want[i])) != 0):
+			t.Errorf("entry %d (%s): interest = %v, want %d", i, e.Kind, e.Interest, want[i])
+		}
+	}
+}
+
+func TestLedgerInterestOpeningPrincipal(t *testing.T) {
+	entries := []*ledgerEntry{
+		{Kind: "repay", Amount: big.NewInt(100), Principal: big.NewInt(920)},
+	}
+	opening := big.NewInt(1000)
+	ledgerInterest(entries, opening)
+	if got := entries[0].Interest; got.Cmp(big.NewInt(20)) != 0 {
+		t.Errorf("interest = %s, want 20", got)
+	}
+	if opening.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("ledgerInterest modified the opening principal: %s", opening)
+	}
+}
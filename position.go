@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"math/big"
+
+	"defi-lending/defi"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// position is a snapshot of a user's lending position read at a single block.
+type position struct {
+	User        common.Address
+	Deposit     *big.Int // Deposits(user), the collateral backing any borrow
+	Shares      *big.Int // DepositShares(user)
+	Principal   *big.Int // Borrows(user).Principal
+	LastAccrued *big.Int // Borrows(user).LastAccrued, a unix timestamp
+	Interest    *big.Int // VerifyInterest(user), interest accrued on top of the principal
+	Threshold   *big.Int // LiquidationThreshold, expressed in percent of the deposit
+}
+
+// loadPosition reads every field of a user's position using the same call options.
+func loadPosition(lending *defi.Defi, opts *bind.CallOpts, user common.Address) (*position, error) {
+	p := &position{User: user}
+	var err error
+	if p.Deposit, err = lending.Deposits(opts, user); err != nil {
+		return nil, err
+	}
+	if p.Shares, err = lending.DepositShares(opts, user); err != nil {
+		return nil, err
+	}
+	borrow, err := lending.Borrows(opts, user)
+	if err != nil {
+		return nil, err
+	}
+	p.Principal, p.LastAccrued = borrow.Principal, borrow.LastAccrued
+	if p.Principal.Sign() > 0 {
+		if p.Interest, err = lending.VerifyInterest(opts, user); err != nil {
+			return nil, err
+		}
+	} else {
+		p.Interest = new(big.Int)
+	}
+	if p.Threshold, err = lending.LiquidationThreshold(opts); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// loadPositions reads the positions of many users at a block in batched round trips. Users whose reads
+// failed get a nil position and their error at the same index; the returned error is a transport failure.
+func loadPositions(ctx context.Context, b *batcher, users []common.Address, block *big.Int) ([]*position, []error, error) {
+	parsed, err := defi.DefiMetaData.GetAbi()
+	if err != nil {
+		return nil, nil, err
+	}
+	lendingAddr := common.HexToAddress(contractAddress)
+	read := func(method string, args ...interface{}) *batchCall {
+		return &batchCall{Target: lendingAddr, ABI: parsed, Method: method, Args: args}
+	}
+	threshold := read("liquidationThreshold")
+	calls := []*batchCall{threshold}
+	perUser := make([][4]*batchCall, len(users))
+	for i, user := range users {
+		// VerifyInterest is read unconditionally because the principal is not known yet.
+		perUser[i] = [4]*batchCall{read("deposits", user), read("depositShares", user), read("borrows", user), read("verifyInterest", user)}
+		calls = append(calls, perUser[i][:]...)
+	}
+	if err := b.call(ctx, block, calls); err != nil {
+		return nil, nil, err
+	}
+	if threshold.Err != nil {
+		return nil, nil, threshold.Err
+	}
+
+	positions, errs := make([]*position, len(users)), make([]error, len(users))
+	for i, user := range users {
+		deposit, shares, borrow, interest := perUser[i][0], perUser[i][1], perUser[i][2], perUser[i][3]
+		for _, c := range []*batchCall{deposit, shares, borrow} {
+			if c.Err != nil && errs[i] == nil {
+				errs[i] = c.Err
+			}
+		}
+		if errs[i] != nil {
+			continue
+		}
+		p := &position{
+			User:        user,
+			Deposit:     deposit.Values[0].(*big.Int),
+			Shares:      shares.Values[0].(*big.Int),
+			Principal:   borrow.Values[0].(*big.Int),
+			LastAccrued: borrow.Values[1].(*big.Int),
+			Interest:    new(big.Int),
+			Threshold:   threshold.Values[0].(*big.Int),
+		}
+		if p.Principal.Sign() > 0 {
+			if interest.Err != nil {
+				errs[i] = interest.Err
+				continue
+			}
+			p.Interest = interest.Values[0].(*big.Int)
+		}
+		positions[i] = p
+	}
+	return positions, errs, nil
+}
+
+// Debt returns the outstanding principal plus accrued interest.
+func (p *position) Debt() *big.Int {
+	return new(big.Int).Add(p.Principal, p.Interest)
+}
+
+// HealthFactor returns the deposit weighted by the liquidation threshold divided by the debt.
+// Positions without debt return nil, meaning an infinite health factor.
+func (p *position) HealthFactor() *big.Float {
+	debt := p.Debt()
+	if debt.Sign() == 0 {
+		return nil
+	}
+	limit := new(big.Float).SetInt(new(big.Int).Mul(p.Deposit, p.Threshold))
+	limit.Quo(limit, big.NewFloat(100))
+	return limit.Quo(limit, new(big.Float).SetInt(debt))
+}
+
+// Liquidatable reports whether the debt exceeds the threshold-weighted deposit.
+func (p *position) Liquidatable() bool {
+	debt := p.Debt()
+	if debt.Sign() == 0 {
+		return false
+	}
+	limit := new(big.Int).Mul(p.Deposit, p.Threshold)
+	return limit.Cmp(new(big.Int).Mul(debt, big.NewInt(100))) < 0
+}
+
+// formatHealth renders a health factor, using "inf" for positions without debt.
+func formatHealth(hf *big.Float) string {
+	if hf == nil {
+		return "inf"
+	}
+	return hf.Text('f', 4)
+}
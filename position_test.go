@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestHealthFactor(t *testing.T) {
+	tests := []struct {
+		deposit, threshold, principal, interest int64
+		want                                    string // "" for no debt
+		liquidatable                            bool
+	}{
+		{1000, 80, 0, 0, "", false},
+		{0, 80, 0, 0, "", false},
+		{1000, 80, 400, 0, "2", false},
+		{1000, 80, 700, 100, "1", false},
+		{1000, 80, 700, 101, "0.9987515605", true},
+		{1000, 75, 300, 0, "2.5", false},
+		{0, 80, 1, 0, "0", true},
+	}
+	for _, tt := range tests {
+		p := &position{
+			Deposit:   big.NewInt(tt.deposit),
+			Threshold: big.NewInt(tt.threshold),
+			Principal: big.NewInt(tt.principal),
+			Interest:  big.NewInt(tt.interest),
+		}
+		hf := p.HealthFactor()
+		switch {
+		case tt.want == "" && hf != nil:
+			t.Errorf("%+v: HealthFactor() = %s, want nil", tt, hf.Text('f', 10))
+		case tt.want != "" && hf == nil:
+			t.Errorf("%+v: HealthFactor() = nil, want %s", tt, tt.want)
+		case tt.want != "":
+			want, _ := new(big.Float).SetString(tt.want)
+			if got := hf.Text('f', 10); got != want.Text('f', 10) {
+				t.Errorf("%+v: HealthFactor() = %s, want %s", tt, got, tt.want)
+			}
+		}
+		if got := p.Liquidatable(); got != tt.liquidatable {
+			t.Errorf("%+v: Liquidatable() = %v, want %v", tt, got, tt.liquidatable)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Signing behaviour of the current command. assumeYes is set by a write command's --yes flag, unattended by the
+// keeper and protect daemons, which sign without a preview and use --dry-run instead.
+var (
+	assumeYes  bool
+	unattended bool
+)
+
+// errNotConfirmed is returned by the signer when the user declines a transaction.
+var errNotConfirmed = fmt.Errorf("transaction not confirmed")
+
+// previewSigner wraps a transactor's signer so every transaction is previewed and confirmed before it is signed.
+// Answering "all" confirms the remaining transactions of the command, such as the deposit after its approval.
+func previewSigner(client *ethclient.Client, signer bind.SignerFn) bind.SignerFn {
+	return func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		if unattended {
+			return signer(from, tx)
+		}
+		printPreview(context.Background(), client, from, tx)
+		if !assumeYes {
+			switch readAnswer("Sign and send? Type 'yes' to continue or 'all' to also confirm later transactions of this command: ") {
+			case "yes":
+			case "all":
+				assumeYes = true
+			default:
+				return nil, errNotConfirmed
+			}
+		}
+		return signer(from, tx)
+	}
+}
+
+// addressLabel names the configured contracts.
+func addressLabel(addr common.Address) string {
+	switch addr {
+	case common.HexToAddress(contractAddress):
+		return "lending " + addr.Hex()
+	case common.HexToAddress(usdcContractAddress):
+		return "uSDC " + addr.Hex()
+	}
+	return addr.Hex()
+}
+
+// printPreview describes a transaction about to be signed: decoded call, fees, projected position and any
+// warnings from simulating it.
+func printPreview(ctx context.Context, client *ethclient.Client, from common.Address, tx *types.Transaction) {
+	var warnings []string
+	fmt.Println("Transaction preview:")
+	fmt.Println("  From:", from.Hex())
+	if tx.To() == nil {
+		fmt.Printf("  To: (contract creation, %d bytes of code and constructor data)\n", len(tx.Data()))
+	} else {
+		fmt.Println("  To:", addressLabel(*tx.To()))
+		if len(tx.Data()) > 0 {
+			printCalldata(tx.Data(), tx.To(), "  ")
+		}
+	}
+	if tx.Value().Sign() > 0 {
+		fmt.Println("  Value:", formatUnits(tx.Value(), 18), "ETH")
+	}
+	fmt.Println("  Nonce:", tx.Nonce())
+	fmt.Println("  Gas limit:", tx.Gas())
+	if tx.Type() == types.LegacyTxType {
+		fmt.Println("  Gas price:", formatUnits(tx.GasPrice(), 9), "gwei")
+	} else {
+		fmt.Printf("  Max fee: %s gwei (tip %s gwei)\n", formatUnits(tx.GasFeeCap(), 9), formatUnits(tx.GasTipCap(), 9))
+	}
+	maxCost := tx.Cost() // gas limit * fee cap + value
+	fmt.Println("  Total max cost:", formatUnits(maxCost, 18), "ETH")
+
+	if balance, err := client.BalanceAt(ctx, from, nil); err != nil {
+		warnings = append(warnings, "could not read the ETH balance: "+err.Error())
+	} else if balance.Cmp(maxCost) < 0 {
+		warnings = append(warnings, fmt.Sprintf("ETH balance %s is below the total max cost", formatUnits(balance, 18)))
+	}
+
+	msg := ethereum.CallMsg{From: from, To: tx.To(), Gas: tx.Gas(), Value: tx.Value(), Data: tx.Data()}
+	if _, err := client.CallContract(ctx, msg, nil); err != nil {
+		reason := err.Error()
+		if data, ok := revertData(err); ok {
+			reason = decodeRevert(data)
+		}
+		warnings = append(warnings, "simulation reverts: "+reason)
+	}
+	warnings = append(warnings, printProjection(ctx, client, from, tx)...)
+
+	for _, w := range warnings {
+		fmt.Println("  WARNING:", w)
+	}
+}
+
+// printProjection prints the sender's position before and after a lending deposit, withdraw, borrow or repay,
+// using the simulate command's model, and returns warnings about the projected position.
+func printProjection(ctx context.Context, client *ethclient.Client, from common.Address, tx *types.Transaction) []string {
+	lendingAddr := common.HexToAddress(contractAddress)
+	if tx.To() == nil || *tx.To() != lendingAddr || len(tx.Data()) < 4 {
+		return nil
+	}
+	_, method, values, err := decodeCalldata(tx.Data(), tx.To())
+	if err != nil || len(values) != 1 {
+		return nil
+	}
+	amount, ok := values[0].(*big.Int)
+	if !ok {
+		return nil
+	}
+	switch method.RawName {
+	case "deposit", "withdraw", "borrow", "repay":
+	default:
+		return nil
+	}
+
+	lending, err := defi.NewDefi(lendingAddr, client)
+	if err != nil {
+		return []string{"could not project the position: " + err.Error()}
+	}
+	usdcToken, err := usdc.NewUsdc(common.HexToAddress(usdcContractAddress), client)
+	if err != nil {
+		return []string{"could not project the position: " + err.Error()}
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	pos, err := loadPosition(lending, opts, from)
+	if err != nil {
+		return []string{"could not read the position: " + err.Error()}
+	}
+	m, err := loadMarket(lending, usdcToken, opts)
+	if err != nil {
+		return []string{"could not read the market: " + err.Error()}
+	}
+	state := &whatIfState{pos: *pos, market: *m}
+	state.print("  Position now:")
+	action := plannedAction{Kind: method.RawName, Amount: amount}
+	if action.Kind == "withdraw" {
+		// Withdraw takes shares; the model works in tokens.
+		action.Amount = new(big.Int).Set(amount)
+		if m.DepositIndex.Sign() > 0 {
+			action.Amount.Mul(action.Amount, m.DepositIndex).Quo(action.Amount, big.NewInt(1e18))
+		}
+	}
+	if arg, err := state.apply(action); err != nil {
+		if arg == nil {
+			return []string{"cannot project the position: " + err.Error()}
+		}
+		state.print("  Position after:")
+		return []string{err.Error()}
+	}
+	state.print("  Position after:")
+	return nil
+}
+
+// stdin is shared by every prompt so input buffered for a later prompt, such as piped answers, is not lost.
+var stdin = bufio.NewReader(os.Stdin)
+
+// readAnswer prints a prompt and returns the trimmed line typed by the user, or "" if stdin is closed.
+func readAnswer(prompt string) string {
+	fmt.Print(prompt)
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(answer)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// profileDir holds one JSON network profile per network.
+const profileDir = "profiles"
+
+// networkProfile records a deployment of the lending system on one network.
+type networkProfile struct {
+	Network                string         `json:"network"`
+	ChainID                uint64         `json:"chainId"`
+	Lending                common.Address `json:"lending"`
+	Token                  common.Address `json:"token"`
+	Implementation         common.Address `json:"implementation"`
+	ImplementationCodeHash common.Hash    `json:"implementationCodeHash"`
+	DeployBlock            uint64         `json:"deployBlock"`
+}
+
+// activeProfile is the profile selected with the global --profile flag, or nil.
+var activeProfile *networkProfile
+
+// profilePath resolves a profile name such as "sepolia" to profiles/sepolia.json; paths ending in .json are used as is.
+func profilePath(name string) string {
+	if strings.HasSuffix(name, ".json") {
+		return name
+	}
+	return filepath.Join(profileDir, name+".json")
+}
+
+// loadProfile reads a network profile.
+func loadProfile(path string) (*networkProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p networkProfile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// writeProfile writes a network profile, creating its directory if needed.
+func writeProfile(path string, p *networkProfile) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// protectAction is one JSON line of the auto-protect audit log.
+type protectAction struct {
+	Time         time.Time `json:"time"`
+	Block        uint64    `json:"block"`
+	Account      string    `json:"account"`
+	Action       string    `json:"action"`
+	Amount       string    `json:"amount"`
+	AmountUnits  string    `json:"amountUnits"`
+	HealthBefore string    `json:"healthBefore"`
+	Status       string    `json:"status"`
+	ApproveTx    string    `json:"approveTx,omitempty"`
+	TxHash       string    `json:"txHash,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// protector keeps the signer's own position above a target health factor.
+type protector struct {
+	client    *ethclient.Client
+	lending   *defi.Defi
+	usdcToken *usdc.Usdc
+	auth      *bind.TransactOpts
+	gas       gasPolicy
+	mode      string
+	trigger   *big.Float
+	target    *big.Float
+	dailyCap  *big.Int
+	dryRun    bool
+	history   []protectAction
+	audit     *json.Encoder
+}
+
+// runProtect implements the protect subcommand.
+func runProtect(client *ethclient.Client, lending *defi.Defi, usdcToken *usdc.Usdc, args []string) {
+	protectCmd := flag.NewFlagSet("protect", flag.ExitOnError)
+	privateKeyFlag := protectCmd.String("private-key", "", "Private key of the protected account")
+	modeFlag := protectCmd.String("mode", "repay", "How to restore health: 'repay' debt or 'deposit' more uSDC")
+	triggerFlag := protectCmd.Float64("trigger", 1.15, "Act when the health factor drops below this value")
+	targetFlag := protectCmd.Float64("target", 1.5, "Health factor to restore the position to")
+	dailyCapFlag := protectCmd.String("daily-cap", "", "Maximum whole tokens spent in any 24h window (required)")
+	intervalFlag := protectCmd.Duration("interval", 12*time.Second, "How often to poll for new blocks")
+	auditFlag := protectCmd.String("audit-log", "protect.log", "File to append every action to (JSON lines)")
+	dryRunFlag := protectCmd.Bool("dry-run", false, "Log the actions that would be taken without sending them")
+	p := &protector{client: client, lending: lending, usdcToken: usdcToken}
+	p.gas.register(protectCmd)
+	protectCmd.Parse(args)
+
+	if *privateKeyFlag == "" || *dailyCapFlag == "" {
+		fmt.Println("Usage: protect --private-key <private-key> --daily-cap <tokens> [--mode repay|deposit] [--trigger 1.15] [--target 1.5] [--max-fee-gwei <gwei>] [--dry-run]")
+		os.Exit(1)
+	}
+	if *modeFlag != "repay" && *modeFlag != "deposit" {
+		log.Fatal("--mode must be 'repay' or 'deposit'")
+	}
+	if *targetFlag <= *triggerFlag || *triggerFlag <= 1 {
+		log.Fatal("--target must be above --trigger, and --trigger above 1")
+	}
+	if p.gas.MaxFeeGwei <= 0 {
+		log.Fatal("--max-fee-gwei is required so the daemon never pays unbounded fees")
+	}
+
+	var err error
+	if p.dailyCap, err = parseToken(*dailyCapFlag); err != nil {
+		log.Fatal("Invalid --daily-cap:", err)
+	}
+	// The daemon signs unattended; --dry-run is its preview.
+	unattended = true
+	if p.auth, err = newTransactor(client, *privateKeyFlag); err != nil {
+		log.Fatal("Failed to create transactor:", err)
+	}
+	p.gas.apply(p.auth)
+	p.mode, p.dryRun = *modeFlag, *dryRunFlag
+	p.trigger, p.target = big.NewFloat(*triggerFlag), big.NewFloat(*targetFlag)
+
+	// Reload past actions so the daily cap survives restarts.
+	if p.history, err = readProtectLog(*auditFlag); err != nil {
+		log.Fatal("Failed to read audit log:", err)
+	}
+	auditFile, err := os.OpenFile(*auditFlag, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Fatal("Failed to open audit log:", err)
+	}
+	defer auditFile.Close()
+	p.audit = json.NewEncoder(auditFile)
+
+	fmt.Printf("Protecting %s: %s when health factor < %s (target %s), daily cap %s\n",
+		p.auth.From.Hex(), p.mode, p.trigger.Text('f', 2), p.target.Text('f', 2), formatToken(p.dailyCap))
+
+	ctx := context.Background()
+	var last uint64
+	ticker := time.NewTicker(*intervalFlag)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			log.Println("Failed to get latest block:", err)
+			continue
+		}
+		if head <= last {
+			continue
+		}
+		last = head
+		p.check(ctx, head)
+	}
+}
+
+// check reads the position at a block and acts when it is below the trigger.
+func (p *protector) check(ctx context.Context, block uint64) {
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(block)}
+	pos, err := loadPosition(p.lending, opts, p.auth.From)
+	if err != nil {
+		log.Println("Failed to read position:", err)
+		return
+	}
+	hf := pos.HealthFactor()
+	if hf == nil || hf.Cmp(p.trigger) >= 0 {
+		return
+	}
+
+	action := protectAction{
+		Time:         time.Now().UTC(),
+		Block:        block,
+		Account:      p.auth.From.Hex(),
+		Action:       p.mode,
+		HealthBefore: formatHealth(hf),
+	}
+	defer func() {
+		if err := p.audit.Encode(action); err != nil {
+			log.Println("Failed to write audit log:", err)
+		}
+		p.history = append(p.history, action)
+		fmt.Printf("[block %d] %s %s: %s %s\n", block, action.Action, action.Amount, action.Status, action.Error)
+	}()
+
+	amount := p.amountToTarget(pos)
+	remaining := new(big.Int).Sub(p.dailyCap, p.spentSince(time.Now().Add(-24*time.Hour)))
+	if remaining.Sign() <= 0 {
+		action.Status, action.Amount, action.AmountUnits = "cap-reached", "0", "0"
+		return
+	}
+	if amount.Cmp(remaining) > 0 {
+		amount = remaining
+	}
+	balance, err := p.usdcToken.BalanceOf(opts, p.auth.From)
+	if err != nil {
+		action.Status, action.Error = "error", err.Error()
+		return
+	}
+	if amount.Cmp(balance) > 0 {
+		amount = balance
+	}
+	action.Amount, action.AmountUnits = formatToken(amount), amount.String()
+	if amount.Sign() == 0 {
+		action.Status = "no-funds"
+		return
+	}
+
+	price, err := p.client.SuggestGasPrice(ctx)
+	if err != nil {
+		action.Status, action.Error = "error", err.Error()
+		return
+	}
+	if price.Cmp(p.auth.GasFeeCap) > 0 {
+		action.Status, action.Error = "fee-too-high", fmt.Sprintf("network gas price %s gwei exceeds max fee", formatUnits(price, 9))
+		return
+	}
+	if p.dryRun {
+		action.Status = "dry-run"
+		return
+	}
+
+	lendingAddr := common.HexToAddress(contractAddress)
+	allowance, err := p.usdcToken.Allowance(opts, p.auth.From, lendingAddr)
+	if err != nil {
+		action.Status, action.Error = "error", err.Error()
+		return
+	}
+	if allowance.Cmp(amount) < 0 {
+		approveTx, err := p.usdcToken.Approve(p.auth, lendingAddr, amount)
+		if err != nil {
+			action.Status, action.Error = "approve-failed", err.Error()
+			return
+		}
+		action.ApproveTx = approveTx.Hash().Hex()
+		if receipt, err := bind.WaitMined(ctx, p.client, approveTx); err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+			action.Status, action.Error = "approve-failed", fmt.Sprint("approval not confirmed: ", err)
+			return
+		}
+	}
+
+	var tx *types.Transaction
+	if p.mode == "repay" {
+		tx, err = p.lending.Repay(p.auth, amount)
+	} else {
+		tx, err = p.lending.Deposit(p.auth, amount)
+	}
+	if err != nil {
+		action.Status, action.Error = "send-failed", err.Error()
+		return
+	}
+	action.TxHash = tx.Hash().Hex()
+	receipt, err := bind.WaitMined(ctx, p.client, tx)
+	switch {
+	case err != nil:
+		action.Status, action.Error = "wait-failed", err.Error()
+	case receipt.Status != types.ReceiptStatusSuccessful:
+		action.Status = "reverted"
+	default:
+		action.Status = "success"
+	}
+}
+
+// amountToTarget returns the repayment or deposit that lifts the position to the target health factor.
+func (p *protector) amountToTarget(pos *position) *big.Int {
+	weighted := new(big.Float).SetInt(new(big.Int).Mul(pos.Deposit, pos.Threshold))
+	weighted.Quo(weighted, big.NewFloat(100))
+	debt := new(big.Float).SetInt(pos.Debt())
+
+	var amount *big.Float
+	if p.mode == "repay" {
+		// debt' = deposit * threshold / 100 / target
+		amount = new(big.Float).Sub(debt, new(big.Float).Quo(weighted, p.target))
+	} else {
+		// deposit' = target * debt * 100 / threshold
+		needed := new(big.Float).Mul(p.target, debt)
+		needed.Mul(needed, big.NewFloat(100))
+		needed.Quo(needed, new(big.Float).SetInt(pos.Threshold))
+		amount = needed.Sub(needed, new(big.Float).SetInt(pos.Deposit))
+	}
+	// A position already at or above the target needs nothing, not a one-unit transaction.
+	if amount.Sign() <= 0 {
+		return new(big.Int)
+	}
+	out, _ := amount.Int(nil)
+	// Round up by one base unit so integer truncation never leaves the position short.
+	return out.Add(out, big.NewInt(1))
+}
+
+// spentSince sums the amounts of sent actions after a point in time.
+func (p *protector) spentSince(since time.Time) *big.Int {
+	total := new(big.Int)
+	for _, a := range p.history {
+		if a.Time.Before(since) || a.TxHash == "" {
+			continue
+		}
+		if amount, ok := new(big.Int).SetString(a.AmountUnits, 10); ok {
+			total.Add(total, amount)
+		}
+	}
+	return total
+}
+
+// readProtectLog loads previous actions from the audit log, if it exists.
+func readProtectLog(path string) ([]protectAction, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var actions []protectAction
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var a protectAction
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, scanner.Err()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestAmountToTarget(t *testing.T) {
+	tests := []struct {
+		mode                                    string
+		target                                  float64
+		deposit, threshold, principal, interest int64
+		want                                    int64
+	}{
+		// weighted deposit 800, debt 700: health 1.14
+		{"repay", 1.5, 1000, 80, 700, 0, 167},
+		{"deposit", 1.5, 1000, 80, 700, 0, 313},
+		{"repay", 1.5, 1000, 80, 600, 100, 167},
+		{"repay", 1.0, 1000, 80, 700, 0, 0},
+		{"deposit", 1.0, 1000, 80, 700, 0, 0},
+		{"repay", 2, 1000, 80, 400, 0, 0}, // exactly at target
+		{"deposit", 2, 1000, 80, 400, 0, 0},
+		{"deposit", 1.2, 0, 80, 100, 0, 150},
+	}
+	for _, tt := range tests {
+		p := &protector{mode: tt.mode, target: big.NewFloat(tt.target)}
+		pos := &position{
+			Deposit:   big.NewInt(tt.deposit),
+			Threshold: big.NewInt(tt.threshold),
+			Principal: big.NewInt(tt.principal),
+			Interest:  big.NewInt(tt.interest),
+		}
+		got := p.amountToTarget(pos)
+		if got.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("%+v: amountToTarget() = %s, want %d", tt, got, tt.want)
+			continue
+		}
+		if got.Sign() == 0 {
+			continue
+		}
+		after := *pos
+		if tt.mode == "repay" {
+			after.Principal = new(big.Int).Sub(pos.Principal, got)
+		} else {
+			after.Deposit = new(big.Int).Add(pos.Deposit, got)
+		}
+		if hf := after.HealthFactor(); hf != nil && hf.Cmp(p.target) < 0 {
+			t.Errorf("%+v: health factor after acting is %s, below the target", tt, hf.Text('f', 6))
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"defi-lending/defi"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ERC-1967 storage slots of a proxy.
+var (
+	erc1967ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	erc1967AdminSlot          = common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103")
+	erc1967BeaconSlot         = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+)
+
+// initializableSlot is the ERC-7201 namespaced slot of OpenZeppelin's InitializableStorage,
+// packing the uint64 _initialized version in the low 8 bytes and the _initializing flag in the next byte.
+var initializableSlot = common.HexToHash("0xf0c57e16840df040f15088dc2f81fe391c3923bec73e23a9662efc9c229c6a00")
+
+// readInitializable reads the initialized version and initializing flag of a proxy.
+func readInitializable(ctx context.Context, client *ethclient.Client, contract common.Address, block *big.Int) (uint64, bool, error) {
+	value, err := client.StorageAt(ctx, contract, initializableSlot, block)
+	if err != nil {
+		return 0, false, err
+	}
+	word := common.BytesToHash(value)
+	return new(big.Int).SetBytes(word[24:]).Uint64(), word[23] != 0, nil
+}
+
+// readAddressSlot reads an address stored right-aligned in a storage slot.
+func readAddressSlot(ctx context.Context, client *ethclient.Client, contract common.Address, slot common.Hash, block *big.Int) (common.Address, error) {
+	value, err := client.StorageAt(ctx, contract, slot, block)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(value), nil
+}
+
+// runInspect implements the inspect subcommand group.
+func runInspect(client *ethclient.Client, lending *defi.Defi, head *types.Header, args []string) {
+	if len(args) == 0 || args[0] != "proxy" {
+		fmt.Println("Usage: inspect proxy [--expected-code-hash <hash>] [--from-block <n>]")
+		os.Exit(1)
+	}
+	inspectCmd := flag.NewFlagSet("inspect proxy", flag.ExitOnError)
+	expectedHash, fromBlock := os.Getenv("EXPECTED_IMPL_CODE_HASH"), uint64(0)
+	if activeProfile != nil {
+		fromBlock = activeProfile.DeployBlock
+		if expectedHash == "" && activeProfile.ImplementationCodeHash != (common.Hash{}) {
+			expectedHash = activeProfile.ImplementationCodeHash.Hex()
+		}
+	}
+	expectedFlag := inspectCmd.String("expected-code-hash", expectedHash, "Expected keccak256 of the implementation's runtime code (default $EXPECTED_IMPL_CODE_HASH, then the profile's)")
+	fromFlag := inspectCmd.Uint64("from-block", fromBlock, "First block to search for Initialized and Upgraded events (default: the profile's deploy block)")
+	inspectCmd.Parse(args[1:])
+
+	// A malformed hash must not pass as a mismatch, which would look like an unexpected upgrade.
+	var expected common.Hash
+	if *expectedFlag != "" {
+		b, err := hexutil.Decode(*expectedFlag)
+		if err != nil {
+			log.Fatalf("Invalid --expected-code-hash %q: %v", *expectedFlag, err)
+		}
+		if len(b) != common.HashLength {
+			log.Fatalf("Invalid --expected-code-hash %q: %d bytes, want %d", *expectedFlag, len(b), common.HashLength)
+		}
+		expected = common.BytesToHash(b)
+	}
+
+	ctx := context.Background()
+	proxy := common.HexToAddress(contractAddress)
+	slots := []struct {
+		name string
+		slot common.Hash
+	}{
+		{"Implementation", erc1967ImplementationSlot},
+		{"Admin", erc1967AdminSlot},
+		{"Beacon", erc1967BeaconSlot},
+	}
+	fmt.Printf("Proxy:          %s (block %s)\n", proxy.Hex(), head.Number)
+	addrs := map[string]common.Address{}
+	for _, s := range slots {
+		addr, err := readAddressSlot(ctx, client, proxy, s.slot, head.Number)
+		if err != nil {
+			log.Fatalf("Failed to read %s slot: %v", s.name, err)
+		}
+		addrs[s.name] = addr
+		value := addr.Hex()
+		if addr == (common.Address{}) {
+			value = "(unset)"
+		}
+		fmt.Printf("%-15s %s\n", s.name+":", value)
+	}
+
+	impl := addrs["Implementation"]
+	code, err := client.CodeAt(ctx, impl, head.Number)
+	if err != nil {
+		log.Fatal("Failed to get implementation code:", err)
+	}
+	codeHash := crypto.Keccak256Hash(code)
+	fmt.Printf("Code hash:      %s (%d bytes)\n", codeHash.Hex(), len(code))
+
+	parsedABI, err := defi.DefiMetaData.GetAbi()
+	if err != nil {
+		log.Fatal("Failed to load lending ABI:", err)
+	}
+	topics := [][]common.Hash{{parsedABI.Events["Initialized"].ID, parsedABI.Events["Upgraded"].ID}}
+	logs, err := fetchLogs(ctx, client, proxy, *fromFlag, head.Number.Uint64(), topics)
+	if err != nil {
+		log.Fatal("Failed to fetch proxy events:", err)
+	}
+	var version uint64
+	var upgrades []*defi.DefiUpgraded
+	for _, l := range logs {
+		switch l.Topics[0] {
+		case parsedABI.Events["Initialized"].ID:
+			evt, err := lending.ParseInitialized(l)
+			if err != nil {
+				log.Fatal("Failed to parse Initialized event:", err)
+			}
+			version = evt.Version
+		case parsedABI.Events["Upgraded"].ID:
+			evt, err := lending.ParseUpgraded(l)
+			if err != nil {
+				log.Fatal("Failed to parse Upgraded event:", err)
+			}
+			upgrades = append(upgrades, evt)
+		}
+	}
+	stored, _, err := readInitializable(ctx, client, proxy, head.Number)
+	if err != nil {
+		log.Fatal("Failed to read initializable slot:", err)
+	}
+	if stored != version {
+		fmt.Printf("WARNING: initializable slot holds version %d, events report %d\n", stored, version)
+	}
+	if version == 0 {
+		fmt.Println("Initialized:    no Initialized event found")
+	} else if version == ^uint64(0) {
+		fmt.Println("Initialized:    initializers disabled")
+	} else {
+		fmt.Println("Initialized:    version", version)
+	}
+
+	fmt.Printf("\nUpgrades (%d):\n", len(upgrades))
+	for _, u := range upgrades {
+		h, err := headerAt(ctx, client, u.Raw.BlockNumber)
+		if err != nil {
+			log.Fatal("Failed to get block header:", err)
+		}
+		fmt.Printf("  %s  block %-10d %s  tx %s\n", time.Unix(int64(h.Time), 0).UTC().Format(time.RFC3339), u.Raw.BlockNumber, u.Implementation.Hex(), u.Raw.TxHash.Hex())
+	}
+	if len(upgrades) > 0 && upgrades[len(upgrades)-1].Implementation != impl {
+		fmt.Println("  WARNING: the last Upgraded event does not match the implementation slot")
+	}
+
+	if *expectedFlag == "" {
+		fmt.Println("\nNo expected code hash configured; pass --expected-code-hash, set EXPECTED_IMPL_CODE_HASH or use a profile to detect unexpected upgrades")
+		return
+	}
+	if codeHash != expected {
+		fmt.Printf("\nUNEXPECTED IMPLEMENTATION: code hash %s, expected %s\n", codeHash.Hex(), expected.Hex())
+		os.Exit(2)
+	}
+	fmt.Println("\nImplementation code hash matches the expected hash")
+}
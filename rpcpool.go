@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Endpoint pool tuning.
+const (
+	rpcMaxAttempts    = 4
+	rpcBaseBackoff    = 250 * time.Millisecond
+	rpcHealthInterval = 15 * time.Second
+	rpcMaxHeadLag     = 3 // blocks behind the best endpoint before an endpoint counts as stale
+	rpcRequestTimeout = 30 * time.Second
+)
+
+// rateLimiter is a token bucket allowing rps requests per second with a burst of one second's worth.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rps    float64
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks until a request may be sent.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.rps, l.tokens+now.Sub(l.last).Seconds()*l.rps)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) / l.rps * float64(time.Second))
+		l.mu.Unlock()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// rpcEndpoint is one node in the pool with its health as of the last check.
+type rpcEndpoint struct {
+	url      string
+	priority int
+	limiter  *rateLimiter // nil when unlimited
+
+	mu      sync.Mutex
+	healthy bool
+	head    uint64
+	reason  string
+}
+
+// rpcPool is an http.RoundTripper spreading JSON-RPC requests over several endpoints. Reads are retried with
+// exponential backoff and fail over to the next healthy endpoint; transactions are only ever rebroadcast as the
+// identical signed bytes, so a retry can never send a second transaction.
+type rpcPool struct {
+	endpoints []*rpcEndpoint // sorted by priority
+	http      *http.Client
+	chainID   *big.Int      // expected chain ID; endpoints reporting another are unhealthy
+	backoff   time.Duration // delay before the first retry, doubled for each later one
+}
+
+// parseRPCEndpoints parses a comma-separated list of "url[;priority=N][;rps=N]" entries. Without a priority,
+// endpoints are preferred in the order given.
+func parseRPCEndpoints(s string) ([]*rpcEndpoint, error) {
+	var endpoints []*rpcEndpoint
+	for i, entry := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ";")
+		if parts[0] == "" {
+			continue
+		}
+		if _, err := url.ParseRequestURI(parts[0]); err != nil {
+			return nil, fmt.Errorf("invalid endpoint %q: %w", parts[0], err)
+		}
+		e := &rpcEndpoint{url: parts[0], priority: i, healthy: true}
+		for _, opt := range parts[1:] {
+			key, value, _ := strings.Cut(opt, "=")
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid option %q for %s", opt, parts[0])
+			}
+			switch key {
+			case "priority":
+				e.priority = int(n)
+			case "rps":
+				if n > 0 {
+					e.limiter = &rateLimiter{rps: n, tokens: n, last: time.Now()}
+				}
+			default:
+				return nil, fmt.Errorf("unknown option %q for %s (known: priority, rps)", key, parts[0])
+			}
+		}
+		endpoints = append(endpoints, e)
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool { return endpoints[i].priority < endpoints[j].priority })
+	return endpoints, nil
+}
+
+// dialRPC connects to RPC_URL. A single plain URL is dialed directly, which keeps websocket subscriptions
+// working; several endpoints, or one with options, go through an rpcPool.
+func dialRPC(ctx context.Context, rpcURL string) (*ethclient.Client, error) {
+	if !strings.ContainsAny(rpcURL, ",;") {
+		return ethclient.Dial(rpcURL)
+	}
+	endpoints, err := parseRPCEndpoints(rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range endpoints {
+		if !strings.HasPrefix(e.url, "http") {
+			return nil, fmt.Errorf("endpoint pools support HTTP endpoints only, got %s", e.url)
+		}
+	}
+	pool := &rpcPool{endpoints: endpoints, http: &http.Client{Timeout: rpcRequestTimeout}, backoff: rpcBaseBackoff}
+	if activeProfile != nil && activeProfile.ChainID != 0 {
+		pool.chainID = new(big.Int).SetUint64(activeProfile.ChainID)
+	}
+	pool.checkHealth(ctx)
+	go func() {
+		for range time.Tick(rpcHealthInterval) {
+			pool.checkHealth(context.Background())
+		}
+	}()
+	// The host is a placeholder; RoundTrip sends every request to a pool endpoint.
+	client, err := rpc.DialOptions(ctx, "http://rpc-pool", rpc.WithHTTPClient(&http.Client{Transport: pool}))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
+
+// jsonrpcMessage is the part of a JSON-RPC request or response the pool inspects.
+type jsonrpcMessage struct {
+	ID     json.RawMessage   `json:"id,omitempty"`
+	Method string            `json:"method,omitempty"`
+	Params []json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage   `json:"result,omitempty"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// call sends a single JSON-RPC request to one endpoint, bypassing the pool.
+func (p *rpcPool) call(ctx context.Context, e *rpcEndpoint, method string, params ...interface{}) (json.RawMessage, error) {
+	body, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.send(e, req, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", method, resp.Status)
+	}
+	var msg jsonrpcMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, err
+	}
+	if msg.Error != nil {
+		return nil, fmt.Errorf("%s: %s", method, msg.Error.Message)
+	}
+	return msg.Result, nil
+}
+
+// checkHealth refreshes every endpoint's chain ID and head and marks wrong-chain, stale or failing ones unhealthy.
+func (p *rpcPool) checkHealth(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, rpcRequestTimeout)
+	defer cancel()
+	type result struct {
+		chainID *big.Int
+		head    uint64
+		err     error
+	}
+	results := make([]result, len(p.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range p.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var r result
+			defer func() { results[i] = r }()
+			var chainID, head hexutil.Big
+			raw, err := p.call(ctx, e, "eth_chainId")
+			if r.err = err; err != nil {
+				return
+			}
+			if r.err = json.Unmarshal(raw, &chainID); r.err != nil {
+				return
+			}
+			if raw, r.err = p.call(ctx, e, "eth_blockNumber"); r.err != nil {
+				return
+			}
+			if r.err = json.Unmarshal(raw, &head); r.err != nil {
+				return
+			}
+			r.chainID, r.head = chainID.ToInt(), head.ToInt().Uint64()
+		}()
+	}
+	wg.Wait()
+
+	// Without a profile, the highest-priority endpoint that answers defines the chain.
+	expected := p.chainID
+	var best uint64
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		if expected == nil {
+			expected = r.chainID
+		}
+		if r.chainID.Cmp(expected) == 0 {
+			best = max(best, r.head)
+		}
+	}
+	for i, e := range p.endpoints {
+		r := results[i]
+		healthy, reason := true, ""
+		switch {
+		case r.err != nil:
+			healthy, reason = false, r.err.Error()
+		case r.chainID.Cmp(expected) != 0:
+			healthy, reason = false, fmt.Sprintf("chain ID %s, expected %s", r.chainID, expected)
+		case best-r.head > rpcMaxHeadLag:
+			healthy, reason = false, fmt.Sprintf("head %d is %d blocks behind", r.head, best-r.head)
+		}
+		e.mu.Lock()
+		if e.healthy != healthy {
+			if healthy {
+				log.Printf("RPC endpoint %s is healthy again", e.url)
+			} else {
+				log.Printf("RPC endpoint %s is unhealthy: %s", e.url, reason)
+			}
+		}
+		e.healthy, e.reason = healthy, reason
+		if r.err == nil {
+			e.head = r.head
+		}
+		e.mu.Unlock()
+	}
+}
+
+// candidates returns healthy endpoints by priority, then unhealthy ones as a last resort.
+func (p *rpcPool) candidates() []*rpcEndpoint {
+	var healthy, unhealthy []*rpcEndpoint
+	for _, e := range p.endpoints {
+		e.mu.Lock()
+		if e.healthy {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+		e.mu.Unlock()
+	}
+	return append(healthy, unhealthy...)
+}
+
+// send posts a request body to one endpoint after waiting for its rate limit.
+func (p *rpcPool) send(e *rpcEndpoint, req *http.Request, body []byte) (*http.Response, error) {
+	if e.limiter != nil {
+		if err := e.limiter.wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	out, err := http.NewRequestWithContext(req.Context(), http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	out.Header = req.Header.Clone()
+	return p.http.Do(out)
+}
+
+// retryableStatus reports HTTP statuses worth retrying elsewhere: rate limiting and server errors.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryableMessages are JSON-RPC error messages, lower-cased, that depend on the endpoint rather than the request:
+// rate limits, and a node that has not caught up with a block another endpoint returned.
+var retryableMessages = []string{"rate limit", "too many requests", "limit exceeded", "header not found", "unknown block", "block not found"}
+
+// retryableRPCError finds an error in a JSON-RPC response or batch response that is worth retrying on another
+// endpoint. Errors such as reverts are answers and are not retried.
+func retryableRPCError(data []byte) error {
+	var msgs []jsonrpcMessage
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if json.Unmarshal(data, &msgs) != nil {
+			return nil
+		}
+	} else {
+		var msg jsonrpcMessage
+		if json.Unmarshal(data, &msg) != nil {
+			return nil
+		}
+		msgs = []jsonrpcMessage{msg}
+	}
+	for _, m := range msgs {
+		if m.Error == nil {
+			continue
+		}
+		// -32005 is the EIP-1474 "limit exceeded" code; some providers use 429.
+		if m.Error.Code == -32005 || m.Error.Code == 429 {
+			return fmt.Errorf("%d: %s", m.Error.Code, m.Error.Message)
+		}
+		lower := strings.ToLower(m.Error.Message)
+		for _, s := range retryableMessages {
+			if strings.Contains(lower, s) {
+				return fmt.Errorf("%d: %s", m.Error.Code, m.Error.Message)
+			}
+		}
+	}
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper for the rpc client.
+func (p *rpcPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var msgs []jsonrpcMessage
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		err = json.Unmarshal(body, &msgs)
+	} else {
+		var msg jsonrpcMessage
+		err = json.Unmarshal(body, &msg)
+		msgs = []jsonrpcMessage{msg}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rpc pool: %w", err)
+	}
+	for _, m := range msgs {
+		switch m.Method {
+		case "eth_sendRawTransaction":
+			if len(msgs) > 1 {
+				return nil, fmt.Errorf("rpc pool: eth_sendRawTransaction cannot be batched")
+			}
+			return p.sendRawTransaction(req, body, m)
+		case "eth_sendTransaction":
+			// The node signs with its own nonce, so a resend could be a second transaction: one attempt only.
+			candidates := p.candidates()
+			if len(candidates) == 0 {
+				return nil, fmt.Errorf("rpc pool: no endpoints")
+			}
+			return p.send(candidates[0], req, body)
+		}
+	}
+
+	var lastErr error
+	for attempt, e := range p.attemptOrder() {
+		if attempt > 0 {
+			if err := sleepCtx(req.Context(), p.backoff<<(attempt-1)); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := p.send(e, req, body)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", e.url, err)
+			continue
+		}
+		if retryableStatus(resp.StatusCode) {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s: %s", e.url, resp.Status)
+			continue
+		}
+		// Rate limits and lagging nodes often answer HTTP 200 with a JSON-RPC error.
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", e.url, err)
+			continue
+		}
+		if err := retryableRPCError(data); err != nil {
+			lastErr = fmt.Errorf("%s: %w", e.url, err)
+			continue
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return resp, nil
+	}
+	return nil, fmt.Errorf("rpc pool: all attempts failed, last: %w", lastErr)
+}
+
+// attemptOrder lists the endpoints to try, cycling through the candidates up to rpcMaxAttempts times.
+func (p *rpcPool) attemptOrder() []*rpcEndpoint {
+	candidates := p.candidates()
+	order := make([]*rpcEndpoint, 0, rpcMaxAttempts)
+	for i := 0; i < rpcMaxAttempts && len(candidates) > 0; i++ {
+		order = append(order, candidates[i%len(candidates)])
+	}
+	return order
+}
+
+// sendRawTransaction broadcasts a signed transaction. A failed attempt is ambiguous (the node may have accepted
+// it), so before rebroadcasting the same bytes elsewhere the pool looks the hash up, and a later "already known"
+// or "nonce too low" answer counts as success only if the transaction is found.
+func (p *rpcPool) sendRawTransaction(req *http.Request, body []byte, msg jsonrpcMessage) (*http.Response, error) {
+	var raw hexutil.Bytes
+	if len(msg.Params) != 1 || json.Unmarshal(msg.Params[0], &raw) != nil {
+		return nil, fmt.Errorf("rpc pool: malformed eth_sendRawTransaction")
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("rpc pool: %w", err)
+	}
+	hash := tx.Hash()
+	known := func() bool {
+		for _, e := range p.candidates() {
+			if result, err := p.call(req.Context(), e, "eth_getTransactionByHash", hash); err == nil && string(result) != "null" {
+				return true
+			}
+		}
+		return false
+	}
+	success := func() (*http.Response, error) {
+		out, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": hash})
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"application/json"}}, Body: io.NopCloser(bytes.NewReader(out)), Request: req}, nil
+	}
+
+	var lastErr error
+	for attempt, e := range p.candidates() {
+		if attempt > 0 && known() {
+			return success()
+		}
+		resp, err := p.send(e, req, body)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", e.url, err)
+			continue
+		}
+		if retryableStatus(resp.StatusCode) {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s: %s", e.url, resp.Status)
+			continue
+		}
+		if attempt == 0 {
+			return resp, nil
+		}
+		// On a rebroadcast, a rejection as a duplicate means an earlier attempt got through.
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var reply jsonrpcMessage
+		if json.Unmarshal(data, &reply) == nil && reply.Error != nil {
+			lower := strings.ToLower(reply.Error.Message)
+			if (strings.Contains(lower, "already known") || strings.Contains(lower, "nonce too low")) && known() {
+				return success()
+			}
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return resp, nil
+	}
+	return nil, fmt.Errorf("rpc pool: transaction %s not confirmed sent by any endpoint, last: %w", hash.Hex(), lastErr)
+}
+
+// sleepCtx waits for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// fakeNode is a JSON-RPC endpoint whose answers are set per test.
+type fakeNode struct {
+	*httptest.Server
+	chainID uint64
+	head    uint64
+
+	mu       sync.Mutex
+	calls    map[string]int
+	received [][]byte               // raw transactions accepted by eth_sendRawTransaction
+	known    map[common.Hash]bool   // transactions eth_getTransactionByHash finds
+	status   int                    // HTTP status answered to every non-health request, if set
+	errors   map[string]*fakeRPCErr // JSON-RPC error answered per method
+	drop     bool                   // close the connection after accepting a transaction
+}
+
+type fakeRPCErr struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	n := &fakeNode{chainID: 1, head: 100, calls: map[string]int{}, known: map[common.Hash]bool{}, errors: map[string]*fakeRPCErr{}}
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(n.Close)
+	return n
+}
+
+func (n *fakeNode) count(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls[req.Method]++
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	health := req.Method == "eth_chainId" || req.Method == "eth_blockNumber"
+	switch {
+	case n.status != 0 && !health:
+		w.WriteHeader(n.status)
+		return
+	case n.errors[req.Method] != nil:
+		resp["error"] = n.errors[req.Method]
+	case req.Method == "eth_chainId":
+		resp["result"] = hexutil.Uint64(n.chainID)
+	case req.Method == "eth_blockNumber":
+		resp["result"] = hexutil.Uint64(n.head)
+	case req.Method == "eth_getTransactionByHash":
+		var hash common.Hash
+		json.Unmarshal(req.Params[0], &hash)
+		if n.known[hash] {
+			resp["result"] = map[string]interface{}{"hash": hash}
+		} else {
+			resp["result"] = nil
+		}
+	case req.Method == "eth_sendRawTransaction":
+		var raw hexutil.Bytes
+		json.Unmarshal(req.Params[0], &raw)
+		tx := new(types.Transaction)
+		tx.UnmarshalBinary(raw)
+		if n.known[tx.Hash()] {
+			resp["error"] = &fakeRPCErr{Code: -32000, Message: "already known"}
+			break
+		}
+		n.received = append(n.received, raw)
+		n.known[tx.Hash()] = true
+		if n.drop {
+			// The node accepted the transaction but the answer is lost.
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		resp["result"] = tx.Hash()
+	default:
+		resp["error"] = &fakeRPCErr{Code: -32601, Message: "method not found"}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// newTestPool connects an ethclient to a pool over the given nodes, in priority order.
+func newTestPool(t *testing.T, nodes ...*fakeNode) (*rpcPool, *ethclient.Client) {
+	urls := make([]string, len(nodes))
+	for i, n := range nodes {
+		urls[i] = n.URL
+	}
+	endpoints, err := parseRPCEndpoints(strings.Join(urls, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := &rpcPool{endpoints: endpoints, http: &http.Client{Timeout: 5 * time.Second}, backoff: time.Millisecond}
+	pool.checkHealth(context.Background())
+	client, err := rpc.DialOptions(context.Background(), "http://rpc-pool", rpc.WithHTTPClient(&http.Client{Transport: pool}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return pool, ethclient.NewClient(client)
+}
+
+// signedTx returns a signed transaction for the send tests.
+func signedTx(t *testing.T) *types.Transaction {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(1)), &types.DynamicFeeTx{
+		ChainID: big.NewInt(1), Nonce: 7, To: &to, Gas: 21000, GasFeeCap: big.NewInt(1e9), GasTipCap: big.NewInt(1e9),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestParseRPCEndpoints(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string // URLs in priority order
+		rps     []float64
+		wantErr bool
+	}{
+		{"http://a,http://b", []string{"http://a", "http://b"}, []float64{0, 0}, false},
+		{"http://a;priority=5,http://b;priority=1", []string{"http://b", "http://a"}, []float64{0, 0}, false},
+		{"http://a;rps=10, http://b", []string{"http://a", "http://b"}, []float64{10, 0}, false},
+		{"http://a,,", []string{"http://a"}, []float64{0}, false},
+		{"http://a;weight=2", nil, nil, true},
+		{"http://a;rps=fast", nil, nil, true},
+		{"http://a;priority=-1", nil, nil, true},
+		{"not a url", nil, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRPCEndpoints(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRPCEndpoints(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseRPCEndpoints(%q) returned %d endpoints, want %d", tt.in, len(got), len(tt.want))
+			continue
+		}
+		for i, e := range got {
+			rps := 0.0
+			if e.limiter != nil {
+				rps = e.limiter.rps
+			}
+			if e.url != tt.want[i] || rps != tt.rps[i] {
+				t.Errorf("parseRPCEndpoints(%q)[%d] = %s rps %v, want %s rps %v", tt.in, i, e.url, rps, tt.want[i], tt.rps[i])
+			}
+		}
+	}
+}
+
+func TestRPCPoolFailsOverOnServerError(t *testing.T) {
+	primary, backup := newFakeNode(t), newFakeNode(t)
+	primary.status = http.StatusBadGateway
+	_, client := newTestPool(t, primary, backup)
+
+	if _, _, err := client.TransactionByHash(context.Background(), common.Hash{1}); err != ethereum.NotFound {
+		t.Fatalf("TransactionByHash error = %v, want not found from the backup", err)
+	}
+	if backup.count("eth_getTransactionByHash") != 1 {
+		t.Errorf("backup served %d requests, want 1", backup.count("eth_getTransactionByHash"))
+	}
+}
+
+func TestRPCPoolRetriesJSONRPCRateLimit(t *testing.T) {
+	for _, rpcErr := range []*fakeRPCErr{
+		{Code: -32005, Message: "limit exceeded"},
+		{Code: -32000, Message: "header not found"},
+		{Code: -32000, Message: "Too Many Requests"},
+	} {
+		primary, backup := newFakeNode(t), newFakeNode(t)
+		primary.errors["eth_getTransactionByHash"] = rpcErr
+		_, client := newTestPool(t, primary, backup)
+		if _, _, err := client.TransactionByHash(context.Background(), common.Hash{1}); err != ethereum.NotFound {
+			t.Errorf("%s: TransactionByHash error = %v, want not found from the backup", rpcErr.Message, err)
+		}
+		if backup.count("eth_getTransactionByHash") != 1 {
+			t.Errorf("%s: backup served %d requests, want 1", rpcErr.Message, backup.count("eth_getTransactionByHash"))
+		}
+	}
+}
+
+func TestRPCPoolDoesNotRetryAnswers(t *testing.T) {
+	primary, backup := newFakeNode(t), newFakeNode(t)
+	primary.errors["eth_getTransactionByHash"] = &fakeRPCErr{Code: 3, Message: "execution reverted"}
+	_, client := newTestPool(t, primary, backup)
+	if _, _, err := client.TransactionByHash(context.Background(), common.Hash{1}); err == nil || !strings.Contains(err.Error(), "execution reverted") {
+		t.Fatalf("TransactionByHash error = %v, want the primary's answer", err)
+	}
+	if backup.count("eth_getTransactionByHash") != 0 {
+		t.Errorf("backup served %d requests, want 0", backup.count("eth_getTransactionByHash"))
+	}
+}
+
+func TestRPCPoolHealthCheck(t *testing.T) {
+	primary, stale, wrongChain, backup := newFakeNode(t), newFakeNode(t), newFakeNode(t), newFakeNode(t)
+	stale.head = primary.head - rpcMaxHeadLag - 1
+	wrongChain.chainID = 5
+	backup.head = primary.head - rpcMaxHeadLag
+	pool, _ := newTestPool(t, primary, stale, wrongChain, backup)
+
+	want := []bool{true, false, false, true}
+	for i, e := range pool.endpoints {
+		if e.healthy != want[i] {
+			t.Errorf("endpoint %d healthy = %v (%s), want %v", i, e.healthy, e.reason, want[i])
+		}
+	}
+	candidates := pool.candidates()
+	if candidates[0] != pool.endpoints[0] || candidates[1] != pool.endpoints[3] {
+		t.Errorf("healthy endpoints are not tried first")
+	}
+}
+
+func TestSendRawTransactionLostAnswerIsNotResent(t *testing.T) {
+	primary, backup := newFakeNode(t), newFakeNode(t)
+	primary.drop = true
+	_, client := newTestPool(t, primary, backup)
+	tx := signedTx(t)
+
+	if err := client.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("SendTransaction = %v, want success once the transaction is found", err)
+	}
+	if len(primary.received) != 1 || backup.count("eth_sendRawTransaction") != 0 {
+		t.Errorf("transaction sent %d times to the primary and %d to the backup, want 1 and 0", len(primary.received), backup.count("eth_sendRawTransaction"))
+	}
+}
+
+func TestSendRawTransactionRebroadcastsIdenticalBytes(t *testing.T) {
+	primary, backup := newFakeNode(t), newFakeNode(t)
+	primary.status = http.StatusServiceUnavailable
+	_, client := newTestPool(t, primary, backup)
+	tx := signedTx(t)
+
+	if err := client.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("SendTransaction = %v", err)
+	}
+	want, _ := tx.MarshalBinary()
+	if len(backup.received) != 1 || string(backup.received[0]) != string(want) {
+		t.Fatalf("backup received %d transactions, want the identical signed bytes once", len(backup.received))
+	}
+}
+
+func TestSendRawTransactionAlreadyKnownAfterRetry(t *testing.T) {
+	primary, backup := newFakeNode(t), newFakeNode(t)
+	primary.status = http.StatusBadGateway
+	tx := signedTx(t)
+	// The first attempt reached the network through the primary before its gateway failed.
+	backup.known[tx.Hash()] = true
+	_, client := newTestPool(t, primary, backup)
+
+	if err := client.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("SendTransaction = %v, want success for a known transaction", err)
+	}
+	if len(backup.received) != 0 {
+		t.Errorf("backup accepted %d transactions, want 0", len(backup.received))
+	}
+}
+
+func TestSendRawTransactionRejectionIsNotRetried(t *testing.T) {
+	primary, backup := newFakeNode(t), newFakeNode(t)
+	primary.errors["eth_sendRawTransaction"] = &fakeRPCErr{Code: -32000, Message: "insufficient funds for gas * price + value"}
+	_, client := newTestPool(t, primary, backup)
+
+	if err := client.SendTransaction(context.Background(), signedTx(t)); err == nil || !strings.Contains(err.Error(), "insufficient funds") {
+		t.Fatalf("SendTransaction = %v, want the primary's rejection", err)
+	}
+	if backup.count("eth_sendRawTransaction") != 0 {
+		t.Errorf("backup was sent the transaction %d times, want 0", backup.count("eth_sendRawTransaction"))
+	}
+}
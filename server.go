@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// openAPISpec documents the REST API served by the serve subcommand.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// apiServer exposes the lending market over HTTP.
+type apiServer struct {
+	client    *ethclient.Client
+	lending   *defi.Defi
+	usdcToken *usdc.Usdc
+	parsedABI *abi.ABI
+	usdcABI   *abi.ABI
+	apiToken  string
+}
+
+// runServe implements the serve subcommand.
+func runServe(client *ethclient.Client, lending *defi.Defi, usdcToken *usdc.Usdc, args []string) {
+	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	listenFlag := serveCmd.String("listen", ":8080", "Address to serve the API on")
+	tokenFlag := serveCmd.String("api-token", os.Getenv("API_TOKEN"), "Bearer token required by write endpoints (default $API_TOKEN; empty disables them)")
+	serveCmd.Parse(args)
+
+	parsedABI, err := defi.DefiMetaData.GetAbi()
+	if err != nil {
+		log.Fatal("Failed to parse DeFiLending ABI:", err)
+	}
+	usdcABI, err := usdc.UsdcMetaData.GetAbi()
+	if err != nil {
+		log.Fatal("Failed to parse uSDC ABI:", err)
+	}
+	s := &apiServer{
+		client:    client,
+		lending:   lending,
+		usdcToken: usdcToken,
+		parsedABI: parsedABI,
+		usdcABI:   usdcABI,
+		apiToken:  *tokenFlag,
+	}
+	if s.apiToken == "" {
+		fmt.Println("No API token configured; transaction endpoints are disabled")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openAPISpec)
+	})
+	mux.HandleFunc("GET /v1/market", s.handleMarket)
+	mux.HandleFunc("GET /v1/positions/{address}", s.handlePosition)
+	mux.HandleFunc("GET /v1/events", s.handleEvents)
+	mux.HandleFunc("GET /v1/tx/{hash}", s.handleTxStatus)
+	mux.HandleFunc("POST /v1/tx/build", s.authenticated(s.handleBuildTx))
+	mux.HandleFunc("POST /v1/tx/submit", s.authenticated(s.handleSubmitTx))
+
+	server := &http.Server{Addr: *listenFlag, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	fmt.Println("Serving API on", *listenFlag)
+	log.Fatal(server.ListenAndServe())
+}
+
+// authenticated rejects requests without the configured bearer token.
+func (s *apiServer) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.apiToken == "" {
+			writeError(w, http.StatusForbidden, "transaction endpoints are disabled")
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.apiToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// marketResponse is the JSON body of GET /v1/market.
+type marketResponse struct {
+	BlockNumber          uint64 `json:"blockNumber"`
+	TotalDeposits        string `json:"totalDeposits"`
+	TotalBorrows         string `json:"totalBorrows"`
+	TotalDepositShares   string `json:"totalDepositShares"`
+	DepositIndex         string `json:"depositIndex"`
+	InterestRate         string `json:"interestRate"`
+	LiquidationThreshold string `json:"liquidationThreshold"`
+	Liquidity            string `json:"liquidity"`
+	Utilization          string `json:"utilization"`
+	Token                string `json:"token"`
+	Owner                string `json:"owner"`
+}
+
+func (s *apiServer) handleMarket(w http.ResponseWriter, r *http.Request) {
+	opts, block, err := s.latestCallOpts(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	m, err := loadMarket(s.lending, s.usdcToken, opts)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, marketResponse{
+		BlockNumber:          block,
+		TotalDeposits:        formatToken(m.TotalDeposits),
+		TotalBorrows:         formatToken(m.TotalBorrows),
+		TotalDepositShares:   m.TotalDepositShares.String(),
+		DepositIndex:         m.DepositIndex.String(),
+		InterestRate:         m.InterestRate.String(),
+		LiquidationThreshold: m.Threshold.String(),
+		Liquidity:            formatToken(m.Liquidity),
+		Utilization:          m.Utilization().Text('f', 6),
+		Token:                m.Token.Hex(),
+		Owner:                m.Owner.Hex(),
+	})
+}
+
+// positionResponse is the JSON body of GET /v1/positions/{address}.
+type positionResponse struct {
+	BlockNumber  uint64 `json:"blockNumber"`
+	Address      string `json:"address"`
+	Deposit      string `json:"deposit"`
+	Shares       string `json:"shares"`
+	Principal    string `json:"principal"`
+	Interest     string `json:"interest"`
+	Debt         string `json:"debt"`
+	LastAccrued  string `json:"lastAccrued"`
+	HealthFactor string `json:"healthFactor"`
+	Liquidatable bool   `json:"liquidatable"`
+}
+
+func (s *apiServer) handlePosition(w http.ResponseWriter, r *http.Request) {
+	addr := r.PathValue("address")
+	if !common.IsHexAddress(addr) {
+		writeError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+	opts, block, err := s.latestCallOpts(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	pos, err := loadPosition(s.lending, opts, common.HexToAddress(addr))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, positionResponse{
+		BlockNumber:  block,
+		Address:      pos.User.Hex(),
+		Deposit:      formatToken(pos.Deposit),
+		Shares:       pos.Shares.String(),
+		Principal:    formatToken(pos.Principal),
+		Interest:     formatToken(pos.Interest),
+		Debt:         formatToken(pos.Debt()),
+		LastAccrued:  pos.LastAccrued.String(),
+		HealthFactor: formatHealth(pos.HealthFactor()),
+		Liquidatable: pos.Liquidatable(),
+	})
+}
+
+// maxEventRange bounds the block range a single events request may scan.
+const maxEventRange = 100000
+
+func (s *apiServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	head, err := s.client.BlockNumber(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	to, err := queryUint(q.Get("toBlock"), head)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid toBlock")
+		return
+	}
+	from, err := queryUint(q.Get("fromBlock"), to-min(to, maxLogRange-1))
+	if err != nil || from > to {
+		writeError(w, http.StatusBadRequest, "invalid fromBlock")
+		return
+	}
+	if to-from >= maxEventRange {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("block range exceeds %d blocks", maxEventRange))
+		return
+	}
+
+	topics := [][]common.Hash{nil}
+	if name := q.Get("event"); name != "" {
+		evt, ok := s.parsedABI.Events[name]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "unknown event "+name)
+			return
+		}
+		topics[0] = []common.Hash{evt.ID}
+	}
+	if user := q.Get("user"); user != "" {
+		if !common.IsHexAddress(user) {
+			writeError(w, http.StatusBadRequest, "invalid user")
+			return
+		}
+		topics = append(topics, []common.Hash{common.BytesToHash(common.HexToAddress(user).Bytes())})
+	}
+
+	logs, err := fetchLogs(r.Context(), s.client, common.HexToAddress(contractAddress), from, to, topics)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	events := make([]*decodedEvent, 0, len(logs))
+	for _, l := range logs {
+		evt, err := decodeEvent(s.parsedABI, l)
+		if err != nil {
+			continue
+		}
+		events = append(events, evt)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"fromBlock": from, "toBlock": to, "events": events})
+}
+
+// txStatusResponse is the JSON body of GET /v1/tx/{hash}.
+type txStatusResponse struct {
+	Hash        string `json:"hash"`
+	Status      string `json:"status"`
+	BlockNumber uint64 `json:"blockNumber,omitempty"`
+	GasUsed     uint64 `json:"gasUsed,omitempty"`
+}
+
+func (s *apiServer) handleTxStatus(w http.ResponseWriter, r *http.Request) {
+	raw := r.PathValue("hash")
+	if b, err := hexutil.Decode(raw); err != nil || len(b) != common.HashLength {
+		writeError(w, http.StatusBadRequest, "invalid transaction hash")
+		return
+	}
+	hash := common.HexToHash(raw)
+	resp := txStatusResponse{Hash: hash.Hex()}
+	receipt, err := s.client.TransactionReceipt(r.Context(), hash)
+	switch {
+	case err == nil:
+		resp.Status, resp.BlockNumber, resp.GasUsed = "success", receipt.BlockNumber.Uint64(), receipt.GasUsed
+		if receipt.Status == types.ReceiptStatusFailed {
+			resp.Status = "failed"
+		}
+	case errors.Is(err, ethereum.NotFound):
+		if _, pending, err := s.client.TransactionByHash(r.Context(), hash); err == nil && pending {
+			resp.Status = "pending"
+		} else {
+			writeError(w, http.StatusNotFound, "transaction not found")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// buildTxRequest is the JSON body of POST /v1/tx/build.
+type buildTxRequest struct {
+	Action string `json:"action"`
+	From   string `json:"from"`
+	Amount string `json:"amount"`
+}
+
+// unsignedTx describes an EIP-1559 transaction for the caller to sign.
+type unsignedTx struct {
+	ChainID              string `json:"chainId"`
+	From                 string `json:"from"`
+	To                   string `json:"to"`
+	Nonce                uint64 `json:"nonce"`
+	Gas                  uint64 `json:"gas"`
+	GasPrice             string `json:"gasPrice,omitempty"` // legacy transactions, on chains without a base fee
+	MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+	Value                string `json:"value"`
+	Data                 string `json:"data"`
+}
+
+func (s *apiServer) handleBuildTx(w http.ResponseWriter, r *http.Request) {
+	var req buildTxRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if !common.IsHexAddress(req.From) {
+		writeError(w, http.StatusBadRequest, "invalid from address")
+		return
+	}
+	from := common.HexToAddress(req.From)
+
+	// Withdraw takes an integer share amount, every other action a token amount.
+	var amount *big.Int
+	var err error
+	switch req.Action {
+	case "deposit", "borrow", "repay":
+		amount, err = parseToken(req.Amount)
+	case "withdraw":
+		var ok bool
+		if amount, ok = new(big.Int).SetString(req.Amount, 10); !ok || amount.Sign() < 0 {
+			err = fmt.Errorf("invalid share amount %q", req.Amount)
+		}
+	default:
+		err = fmt.Errorf("action must be one of deposit, withdraw, borrow, repay")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if amount.Sign() == 0 {
+		writeError(w, http.StatusBadRequest, "amount must be positive")
+		return
+	}
+
+	ctx := r.Context()
+	lendingAddr := common.HexToAddress(contractAddress)
+	data, err := s.parsedABI.Pack(req.Action, amount)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp := map[string]interface{}{}
+
+	// Deposits and repayments pull tokens, so they need an approval first.
+	if req.Action == "deposit" || req.Action == "repay" {
+		allowance, err := s.usdcToken.Allowance(&bind.CallOpts{Context: ctx}, from, lendingAddr)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		if allowance.Cmp(amount) < 0 {
+			approveData, err := s.usdcABI.Pack("approve", lendingAddr, amount)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			approveTx, err := s.buildTx(ctx, from, common.HexToAddress(usdcContractAddress), approveData, 0)
+			if err != nil {
+				writeError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			resp["approval"] = approveTx
+		}
+	}
+
+	nonceOffset := uint64(0)
+	if resp["approval"] != nil {
+		nonceOffset = 1
+	}
+	tx, err := s.buildTx(ctx, from, lendingAddr, data, nonceOffset)
+	if err != nil && resp["approval"] == nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		// Gas cannot be estimated before the approval is mined.
+		resp["warning"] = "gas estimate unavailable until the approval is mined: " + err.Error()
+	}
+	resp["transaction"] = tx
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// buildTx fills nonce, fees and gas for a call from an address.
+// The transaction is still returned when gas estimation fails, together with the error.
+func (s *apiServer) buildTx(ctx context.Context, from, to common.Address, data []byte, nonceOffset uint64) (*unsignedTx, error) {
+	chainID, err := s.client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := s.client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	head, err := s.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	tx := &unsignedTx{
+		ChainID: chainID.String(),
+		From:    from.Hex(),
+		To:      to.Hex(),
+		Nonce:   nonce + nonceOffset,
+		Value:   "0",
+		Data:    hexutil.Encode(data),
+	}
+	if head.BaseFee == nil {
+		// Chains without EIP-1559 take a legacy gas price.
+		gasPrice, err := s.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tx.GasPrice = gasPrice.String()
+	} else {
+		tip, err := s.client.SuggestGasTipCap(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tx.MaxFeePerGas = new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip).String()
+		tx.MaxPriorityFeePerGas = tip.String()
+	}
+	gas, err := s.client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Data: data})
+	if err != nil {
+		return tx, fmt.Errorf("transaction would revert: %w", err)
+	}
+	tx.Gas = gas
+	return tx, nil
+}
+
+// submitTxRequest is the JSON body of POST /v1/tx/submit.
+type submitTxRequest struct {
+	RawTransaction string `json:"rawTransaction"`
+}
+
+func (s *apiServer) handleSubmitTx(w http.ResponseWriter, r *http.Request) {
+	var req submitTxRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	raw, err := hexutil.Decode(req.RawTransaction)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "rawTransaction must be 0x-prefixed hex")
+		return
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid signed transaction: "+err.Error())
+		return
+	}
+	to := tx.To()
+	if to == nil || (*to != common.HexToAddress(contractAddress) && *to != common.HexToAddress(usdcContractAddress)) {
+		writeError(w, http.StatusBadRequest, "transaction must target the lending or uSDC contract")
+		return
+	}
+	if err := s.client.SendTransaction(r.Context(), tx); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"hash": tx.Hash().Hex()})
+}
+
+// latestCallOpts pins reads of one request to the current head.
+func (s *apiServer) latestCallOpts(ctx context.Context) (*bind.CallOpts, uint64, error) {
+	head, err := s.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(head)}, head, nil
+}
+
+// queryUint parses an optional unsigned query parameter.
+func queryUint(s string, def uint64) (uint64, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
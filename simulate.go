@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// secondsPerYear converts the annual InterestRate into per-second accrual.
+const secondsPerYear = 365 * 24 * 60 * 60
+
+// accruedInterest applies the contract's rate model: simple interest at InterestRate percent per year
+// on the principal, accrued linearly from lastAccrued to the given time.
+func accruedInterest(principal, rate, lastAccrued *big.Int, at uint64) *big.Int {
+	if principal.Sign() == 0 || lastAccrued.Uint64() >= at {
+		return new(big.Int)
+	}
+	elapsed := new(big.Int).SetUint64(at - lastAccrued.Uint64())
+	interest := new(big.Int).Mul(principal, rate)
+	interest.Mul(interest, elapsed)
+	return interest.Quo(interest, big.NewInt(100*secondsPerYear))
+}
+
+// runSimulate implements the simulate subcommand: "simulate interest" projects debt forward,
+// anything else is a sequence of planned actions.
+func runSimulate(client *ethclient.Client, lending *defi.Defi, usdcToken *usdc.Usdc, head *types.Header, args []string) {
+	if len(args) > 0 && args[0] == "interest" {
+		simulateInterest(lending, head, args[1:])
+		return
+	}
+	simulateActions(client, lending, usdcToken, head, args)
+}
+
+// simulateInterest projects a borrower's debt forward and cross-checks the model against VerifyInterest.
+func simulateInterest(lending *defi.Defi, head *types.Header, args []string) {
+	interestCmd := flag.NewFlagSet("simulate interest", flag.ExitOnError)
+	addressFlag := interestCmd.String("address", "", "Borrower address (e.g., 0x...)")
+	horizonFlag := interestCmd.Duration("horizon", 30*24*time.Hour, "How far ahead to project the debt")
+	stepFlag := interestCmd.Duration("step", 24*time.Hour, "Interval between projected rows")
+	toleranceFlag := interestCmd.Float64("tolerance", 0.01, "Relative difference from VerifyInterest that is flagged as a discrepancy")
+	interestCmd.Parse(args)
+
+	if !common.IsHexAddress(*addressFlag) {
+		fmt.Println("Usage: simulate interest --address <address> [--horizon 720h] [--step 24h]")
+		os.Exit(1)
+	}
+	// Rows are stepped in whole seconds, so anything shorter would never advance.
+	if *stepFlag < time.Second {
+		log.Fatal("--step must be at least 1s")
+	}
+	user := common.HexToAddress(*addressFlag)
+	opts := &bind.CallOpts{Context: context.Background(), BlockNumber: head.Number}
+	pos, err := loadPosition(lending, opts, user)
+	if err != nil {
+		log.Fatal("Failed to read position:", err)
+	}
+	rate, err := lending.InterestRate(opts)
+	if err != nil {
+		log.Fatal("Failed to get interest rate:", err)
+	}
+	if pos.Principal.Sign() == 0 {
+		fmt.Printf("%s has no outstanding borrow\n", user.Hex())
+		return
+	}
+
+	now := head.Time
+	fmt.Printf("Borrower:      %s (block %s)\n", user.Hex(), head.Number)
+	fmt.Printf("Principal:     %s, last accrued %s\n", formatToken(pos.Principal), time.Unix(pos.LastAccrued.Int64(), 0).UTC().Format(time.RFC3339))
+	fmt.Printf("Rate:          %s%% per year (simple)\n", rate)
+	fmt.Printf("Deposit:       %s, liquidation threshold %s%%\n", formatToken(pos.Deposit), pos.Threshold)
+
+	// Cross-check the model against the contract's own view of accrued interest.
+	modelled := accruedInterest(pos.Principal, rate, pos.LastAccrued, now)
+	fmt.Printf("Interest now:  model %s, VerifyInterest %s", formatToken(modelled), formatToken(pos.Interest))
+	diff := new(big.Int).Abs(new(big.Int).Sub(modelled, pos.Interest))
+	if pos.Interest.Sign() > 0 {
+		rel, _ := ratio(diff, pos.Interest).Float64()
+		if rel > *toleranceFlag {
+			fmt.Printf("  DISCREPANCY %.2f%%: the rate model does not match the contract\n", rel*100)
+		} else {
+			fmt.Println("  (match)")
+		}
+	} else if diff.Sign() > 0 {
+		fmt.Println("  DISCREPANCY: the contract reports no interest")
+	} else {
+		fmt.Println("  (match)")
+	}
+
+	// limit is the debt at which the position becomes liquidatable.
+	limit := new(big.Int).Mul(pos.Deposit, pos.Threshold)
+	limit.Quo(limit, big.NewInt(100))
+
+	fmt.Printf("\n%-22s %16s %16s %10s\n", "time", "interest", "debt", "health")
+	for t := now; t <= now+uint64(horizonFlag.Seconds()); t += uint64(stepFlag.Seconds()) {
+		projected := *pos
+		projected.Interest = accruedInterest(pos.Principal, rate, pos.LastAccrued, t)
+		fmt.Printf("%-22s %16s %16s %10s\n", time.Unix(int64(t), 0).UTC().Format(time.RFC3339),
+			formatToken(projected.Interest), formatToken(projected.Debt()), formatHealth(projected.HealthFactor()))
+	}
+
+	// Solve principal + accrued(t) = limit for t.
+	fmt.Println()
+	switch {
+	case pos.Principal.Cmp(limit) >= 0 || new(big.Int).Add(pos.Principal, modelled).Cmp(limit) > 0:
+		fmt.Println("The position is already past the liquidation threshold")
+	case rate.Sign() == 0:
+		fmt.Println("The interest rate is zero; the position never crosses the liquidation threshold")
+	default:
+		headroom := new(big.Int).Sub(limit, pos.Principal)
+		seconds := new(big.Int).Mul(headroom, big.NewInt(100*secondsPerYear))
+		seconds.Quo(seconds, new(big.Int).Mul(pos.Principal, rate))
+		crossing := pos.LastAccrued.Uint64() + seconds.Uint64()
+		fmt.Printf("Crosses the liquidation threshold at %s (in %s) if nothing changes\n",
+			time.Unix(int64(crossing), 0).UTC().Format(time.RFC3339), (time.Duration(crossing-now) * time.Second).String())
+	}
+}
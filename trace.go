@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// callFrame is a frame of the callTracer output of debug_traceTransaction.
+type callFrame struct {
+	Type         string          `json:"type"`
+	From         common.Address  `json:"from"`
+	To           *common.Address `json:"to"`
+	Value        *hexutil.Big    `json:"value"`
+	Gas          hexutil.Uint64  `json:"gas"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	Input        hexutil.Bytes   `json:"input"`
+	Output       hexutil.Bytes   `json:"output"`
+	Error        string          `json:"error"`
+	RevertReason string          `json:"revertReason"`
+	Calls        []callFrame     `json:"calls"`
+	Logs         []callLog       `json:"logs"` // only with the tracer's withLog option
+}
+
+// callLog is a log emitted by a frame, as reported by the callTracer.
+type callLog struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    hexutil.Bytes  `json:"data"`
+}
+
+// selfGas is the gas a frame used excluding its subcalls.
+func (f *callFrame) selfGas() uint64 {
+	used := uint64(f.GasUsed)
+	for _, c := range f.Calls {
+		if uint64(c.GasUsed) > used {
+			return 0
+		}
+		used -= uint64(c.GasUsed)
+	}
+	return used
+}
+
+// originatesRevert reports whether a failed frame failed on its own rather than by bubbling up a failed subcall.
+func (f *callFrame) originatesRevert() bool {
+	if f.Error == "" {
+		return false
+	}
+	for _, c := range f.Calls {
+		if c.Error != "" && bytes.Equal(c.Output, f.Output) {
+			return false
+		}
+	}
+	return true
+}
+
+// tracer prints call trees with frames labelled and decoded against the bundled ABIs.
+type tracer struct {
+	labels map[common.Address]string
+	proxy  common.Address
+	impl   common.Address
+}
+
+// label names a known address.
+func (t *tracer) label(addr common.Address) string {
+	if name, ok := t.labels[addr]; ok {
+		return name + " " + addr.Hex()
+	}
+	return addr.Hex()
+}
+
+// print writes a frame and its subcalls.
+func (t *tracer) print(f *callFrame, depth int) {
+	indent := strings.Repeat("  ", depth)
+	to := "(create)"
+	if f.To != nil {
+		to = t.label(*f.To)
+	}
+	fn := ""
+	if len(f.Input) >= 4 && f.To != nil {
+		// The implementation runs with the proxy's ABI, so decode delegatecalls to it as lending calls.
+		target := *f.To
+		if target == t.impl {
+			target = t.proxy
+		}
+		if contract, method, _, err := decodeCalldata(f.Input, &target); method != nil && err == nil {
+			fn = " " + contract + "." + method.Sig
+		} else {
+			fn = fmt.Sprintf(" 0x%x", f.Input[:4])
+		}
+	}
+	value := ""
+	if f.Value != nil && f.Value.ToInt().Sign() > 0 {
+		value = " value " + formatUnits(f.Value.ToInt(), 18) + " ETH"
+	}
+	fmt.Printf("%s%s %s%s%s  gas %d/%d (self %d)\n", indent, f.Type, to, fn, value, uint64(f.GasUsed), uint64(f.Gas), f.selfGas())
+	if f.Error != "" {
+		reason := f.Error
+		if len(f.Output) > 0 {
+			reason += ": " + decodeRevert(f.Output)
+		} else if f.RevertReason != "" {
+			reason += ": " + f.RevertReason
+		}
+		marker := ""
+		if f.originatesRevert() {
+			marker = "  <- revert originated here"
+		}
+		fmt.Printf("%s  ! %s%s\n", indent, reason, marker)
+	}
+	for i := range f.Calls {
+		t.print(&f.Calls[i], depth+1)
+	}
+}
+
+// runTrace implements the trace subcommand group.
+func runTrace(client *ethclient.Client, args []string) {
+	if len(args) != 2 || args[0] != "tx" || len(args[1]) != 66 {
+		fmt.Println("Usage: trace tx <hash>")
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	hash := common.HexToHash(args[1])
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if err != nil {
+		log.Fatal("Failed to get receipt:", err)
+	}
+
+	var root callFrame
+	if err := client.Client().CallContext(ctx, &root, "debug_traceTransaction", hash, map[string]interface{}{"tracer": "callTracer"}); err != nil {
+		log.Fatal("debug_traceTransaction failed (the node must expose the debug API):", err)
+	}
+
+	proxy := common.HexToAddress(contractAddress)
+	t := &tracer{
+		labels: map[common.Address]string{
+			proxy:                                    "lending",
+			common.HexToAddress(usdcContractAddress): "uSDC",
+		},
+		proxy: proxy,
+	}
+	// The implementation at the transaction's block, so delegatecalls to it are recognised after upgrades.
+	if impl, err := readAddressSlot(ctx, client, proxy, erc1967ImplementationSlot, receipt.BlockNumber); err == nil && impl != (common.Address{}) {
+		t.impl = impl
+		t.labels[impl] = "lending-impl"
+	}
+
+	// The top frame's gas includes the intrinsic cost of the transaction, so it matches the receipt.
+	fmt.Printf("Transaction %s in block %s, gas used %d\n\n", hash.Hex(), receipt.BlockNumber, receipt.GasUsed)
+	t.print(&root, 0)
+}
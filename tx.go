@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"defi-lending/defi"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// forceWrites skips the pre-flight refusal of newTransactor; set by the global --force flag.
+var forceWrites bool
+
+// newTransactor creates an authorized transactor from a hex-encoded private key after checking the node is on
+// the expected chain and the configured contracts look right.
+func newTransactor(client *ethclient.Client, privateKeyHex string) (*bind.TransactOpts, error) {
+	auth, err := chainTransactor(client, privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	if err := preflight(checkContracts(context.Background(), client)); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// chainTransactor creates a transactor checking only the chain ID, for writes that run before the configured
+// contracts exist or are initialized.
+func chainTransactor(client *ethclient.Client, privateKeyHex string) (*bind.TransactOpts, error) {
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if activeProfile == nil || activeProfile.ChainID == 0 {
+		log.Printf("Warning: no profile with a chain ID is selected; signing for chain %s as reported by the node", chainID)
+	}
+	if err := preflight(chainProblems(chainID), nil); err != nil {
+		return nil, err
+	}
+	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainID)
+	if err != nil {
+		return nil, err
+	}
+	auth.Signer = previewSigner(client, auth.Signer)
+	return auth, nil
+}
+
+// chainProblems compares the node's chain ID with the active profile's, if it has one.
+func chainProblems(chainID *big.Int) []string {
+	if activeProfile == nil || activeProfile.ChainID == 0 {
+		return nil
+	}
+	if chainID.Uint64() != activeProfile.ChainID {
+		return []string{fmt.Sprintf("node is on chain %s but profile %s expects chain %d", chainID, activeProfile.Network, activeProfile.ChainID)}
+	}
+	return nil
+}
+
+// checkContracts lists problems with the configured addresses: missing code, or a lending contract whose token
+// is not the configured uSDC.
+func checkContracts(ctx context.Context, client *ethclient.Client) ([]string, error) {
+	var problems []string
+	lendingAddr, tokenAddr := common.HexToAddress(contractAddress), common.HexToAddress(usdcContractAddress)
+	for _, c := range []struct {
+		name string
+		addr common.Address
+	}{{"lending contract", lendingAddr}, {"uSDC token", tokenAddr}} {
+		code, err := client.CodeAt(ctx, c.addr, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(code) == 0 {
+			problems = append(problems, fmt.Sprintf("%s %s has no code", c.name, c.addr.Hex()))
+		}
+	}
+	if len(problems) > 0 {
+		return problems, nil
+	}
+	lending, err := defi.NewDefiCaller(lendingAddr, client)
+	if err != nil {
+		return nil, err
+	}
+	token, err := lending.Token(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("lending contract %s has no token(): %v", lendingAddr.Hex(), err))
+	} else if token != tokenAddr {
+		problems = append(problems, fmt.Sprintf("lending contract token is %s, not the configured uSDC %s", token.Hex(), tokenAddr.Hex()))
+	}
+	return problems, nil
+}
+
+// preflight refuses to sign when there are problems unless --force is set, in which case they are only logged.
+func preflight(problems []string, err error) error {
+	if err != nil {
+		return fmt.Errorf("pre-flight checks failed: %w", err)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if forceWrites {
+		for _, p := range problems {
+			log.Println("Warning (--force):", p)
+		}
+		return nil
+	}
+	return fmt.Errorf("refusing to sign (use --force to override): %s", strings.Join(problems, "; "))
+}
+
+// gasPolicy bounds the fees of outgoing transactions. Zero values leave the choice to the node.
+type gasPolicy struct {
+	MaxFeeGwei float64
+	TipGwei    float64
+	GasLimit   uint64
+}
+
+// register adds the gas policy flags to a subcommand's flag set.
+func (g *gasPolicy) register(fs *flag.FlagSet) {
+	fs.Float64Var(&g.MaxFeeGwei, "max-fee-gwei", 0, "Maximum fee per gas in gwei (0 uses the node's suggestion)")
+	fs.Float64Var(&g.TipGwei, "tip-gwei", 0, "Priority fee per gas in gwei (0 uses the node's suggestion)")
+	fs.Uint64Var(&g.GasLimit, "gas-limit", 0, "Gas limit (0 estimates it)")
+}
+
+// apply copies the policy onto a transactor.
+func (g *gasPolicy) apply(auth *bind.TransactOpts) {
+	if g.MaxFeeGwei > 0 {
+		auth.GasFeeCap = gweiToWei(g.MaxFeeGwei)
+	}
+	if g.TipGwei > 0 {
+		auth.GasTipCap = gweiToWei(g.TipGwei)
+	}
+	auth.GasLimit = g.GasLimit
+}
+
+// maxFeePerGas returns the fee cap a transaction would pay under this policy.
+func (g *gasPolicy) maxFeePerGas(ctx context.Context, client *ethclient.Client) (*big.Int, error) {
+	if g.MaxFeeGwei > 0 {
+		return gweiToWei(g.MaxFeeGwei), nil
+	}
+	return client.SuggestGasPrice(ctx)
+}
+
+// gweiToWei converts a gwei amount to wei.
+func gweiToWei(gwei float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(gwei), big.NewFloat(params.GWei)).Int(nil)
+	return wei
+}
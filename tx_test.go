@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestChainProblems(t *testing.T) {
+	defer func(p *networkProfile) { activeProfile = p }(activeProfile)
+	tests := []struct {
+		name        string
+		profile     *networkProfile
+		chainID     int64
+		wantProblem bool
+	}{
+		{"no profile", nil, 1, false},
+		{"profile without chain ID", &networkProfile{Network: "dev"}, 1, false},
+		{"matching chain", &networkProfile{Network: "sepolia", ChainID: 11155111}, 11155111, false},
+		{"wrong chain", &networkProfile{Network: "sepolia", ChainID: 11155111}, 1, true},
+	}
+	for _, tt := range tests {
+		activeProfile = tt.profile
+		problems := chainProblems(big.NewInt(tt.chainID))
+		if (len(problems) > 0) != tt.wantProblem {
+			t.Errorf("%s: chainProblems = %q, want problem %v", tt.name, problems, tt.wantProblem)
+		}
+	}
+}
+
+func TestPreflightForce(t *testing.T) {
+	defer func(f bool) { forceWrites = f }(forceWrites)
+	forceWrites = false
+	if err := preflight([]string{"wrong chain"}, nil); err == nil {
+		t.Error("preflight accepted a problem without --force")
+	}
+	if err := preflight(nil, nil); err != nil {
+		t.Errorf("preflight without problems = %v", err)
+	}
+	forceWrites = true
+	if err := preflight([]string{"wrong chain"}, nil); err != nil {
+		t.Errorf("preflight with --force = %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// tokenDecimals is the number of decimals used by the uSDC token (like USDC).
+const tokenDecimals = 6
+
+// tokenUnit is one whole token expressed in the token's smallest unit.
+var tokenUnit = new(big.Int).Exp(big.NewInt(10), big.NewInt(tokenDecimals), nil)
+
+// formatUnits renders an integer amount with the given number of decimals, trimming trailing zeros.
+func formatUnits(amount *big.Int, decimals int) string {
+	if amount == nil {
+		return "0"
+	}
+	neg := amount.Sign() < 0
+	s := new(big.Int).Abs(amount).String()
+	if decimals > 0 {
+		if len(s) <= decimals {
+			s = strings.Repeat("0", decimals-len(s)+1) + s
+		}
+		whole, frac := s[:len(s)-decimals], strings.TrimRight(s[len(s)-decimals:], "0")
+		s = whole
+		if frac != "" {
+			s += "." + frac
+		}
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// formatToken renders an amount of uSDC base units as whole tokens.
+func formatToken(amount *big.Int) string {
+	return formatUnits(amount, tokenDecimals)
+}
+
+// parseUnits parses a decimal string such as "10.5" into an integer amount with the given number of decimals.
+func parseUnits(s string, decimals int) (*big.Int, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if len(frac) > decimals {
+		return nil, fmt.Errorf("amount %q has more than %d decimals", s, decimals)
+	}
+	amount, ok := new(big.Int).SetString(whole+frac+strings.Repeat("0", decimals-len(frac)), 10)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	return amount, nil
+}
+
+// parseToken parses a whole-token amount such as "10.5" into uSDC base units.
+func parseToken(s string) (*big.Int, error) {
+	return parseUnits(s, tokenDecimals)
+}
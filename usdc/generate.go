@@ -0,0 +1,3 @@
+package usdc
+
+//go:generate go run ../cmd/genbindings -contract uSDC -pkg usdc -type Usdc -out usdc.go
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"defi-lending/defi"
+	"defi-lending/usdc"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+)
+
+// plannedAction is one hypothetical deposit, withdraw, borrow or repay, amounts in uSDC base units.
+type plannedAction struct {
+	Kind   string
+	Amount *big.Int
+}
+
+// parsePlannedActions parses arguments of the form kind:amount, e.g. "deposit:100".
+func parsePlannedActions(args []string) ([]plannedAction, error) {
+	actions := make([]plannedAction, 0, len(args))
+	for _, arg := range args {
+		kind, amount, ok := strings.Cut(arg, ":")
+		if !ok {
+			return nil, fmt.Errorf("action %q must look like kind:amount", arg)
+		}
+		switch kind {
+		case "deposit", "withdraw", "borrow", "repay":
+		default:
+			return nil, fmt.Errorf("unknown action %q: expected deposit, withdraw, borrow or repay", kind)
+		}
+		value, err := parseToken(amount)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, plannedAction{Kind: kind, Amount: value})
+	}
+	return actions, nil
+}
+
+// whatIfState is the part of the position and market a planned action changes.
+type whatIfState struct {
+	pos    position
+	market market
+}
+
+// apply updates the state for an action and returns the contract call arguments it maps to.
+// Withdrawals are converted from tokens to the shares Withdraw expects.
+func (s *whatIfState) apply(a plannedAction) (*big.Int, error) {
+	p, m := &s.pos, &s.market
+	switch a.Kind {
+	case "deposit":
+		shares := tokensToShares(a.Amount, m.DepositIndex)
+		p.Deposit = new(big.Int).Add(p.Deposit, a.Amount)
+		p.Shares = new(big.Int).Add(p.Shares, shares)
+		m.TotalDeposits = new(big.Int).Add(m.TotalDeposits, a.Amount)
+		m.TotalDepositShares = new(big.Int).Add(m.TotalDepositShares, shares)
+		m.Liquidity = new(big.Int).Add(m.Liquidity, a.Amount)
+		return a.Amount, nil
+	case "withdraw":
+		if a.Amount.Cmp(p.Deposit) > 0 {
+			return nil, fmt.Errorf("withdraw of %s exceeds the deposit of %s", formatToken(a.Amount), formatToken(p.Deposit))
+		}
+		if a.Amount.Cmp(m.Liquidity) > 0 {
+			return nil, fmt.Errorf("withdraw of %s exceeds available liquidity of %s", formatToken(a.Amount), formatToken(m.Liquidity))
+		}
+		shares := tokensToShares(a.Amount, m.DepositIndex)
+		if shares.Cmp(p.Shares) > 0 {
+			shares = new(big.Int).Set(p.Shares)
+		}
+		p.Deposit = new(big.Int).Sub(p.Deposit, a.Amount)
+		p.Shares = new(big.Int).Sub(p.Shares, shares)
+		m.TotalDeposits = new(big.Int).Sub(m.TotalDeposits, a.Amount)
+		m.TotalDepositShares = new(big.Int).Sub(m.TotalDepositShares, shares)
+		m.Liquidity = new(big.Int).Sub(m.Liquidity, a.Amount)
+		if p.Liquidatable() {
+			return shares, fmt.Errorf("withdraw leaves the position below the liquidation threshold")
+		}
+		return shares, nil
+	case "borrow":
+		if a.Amount.Cmp(m.Liquidity) > 0 {
+			return nil, fmt.Errorf("borrow of %s exceeds available liquidity of %s", formatToken(a.Amount), formatToken(m.Liquidity))
+		}
+		// Borrowing capitalizes accrued interest into the principal.
+		p.Principal = new(big.Int).Add(p.Debt(), a.Amount)
+		p.Interest = new(big.Int)
+		m.TotalBorrows = new(big.Int).Add(m.TotalBorrows, a.Amount)
+		m.Liquidity = new(big.Int).Sub(m.Liquidity, a.Amount)
+		if p.Liquidatable() {
+			return a.Amount, fmt.Errorf("borrow leaves the position below the liquidation threshold")
+		}
+		return a.Amount, nil
+	case "repay":
+		debt := p.Debt()
+		if a.Amount.Cmp(debt) > 0 {
+			return nil, fmt.Errorf("repay of %s exceeds the debt of %s", formatToken(a.Amount), formatToken(debt))
+		}
+		p.Principal = new(big.Int).Sub(debt, a.Amount)
+		p.Interest = new(big.Int)
+		m.TotalBorrows = new(big.Int).Sub(m.TotalBorrows, a.Amount)
+		if m.TotalBorrows.Sign() < 0 {
+			m.TotalBorrows.SetInt64(0)
+		}
+		m.Liquidity = new(big.Int).Add(m.Liquidity, a.Amount)
+		return a.Amount, nil
+	}
+	return nil, fmt.Errorf("unknown action %q", a.Kind)
+}
+
+// MaxBorrowable returns how much more can be borrowed before reaching the liquidation threshold,
+// capped by available liquidity.
+func (s *whatIfState) MaxBorrowable() *big.Int {
+	limit := new(big.Int).Mul(s.pos.Deposit, s.pos.Threshold)
+	limit.Quo(limit, big.NewInt(100))
+	limit.Sub(limit, s.pos.Debt())
+	if limit.Sign() < 0 {
+		return new(big.Int)
+	}
+	if limit.Cmp(s.market.Liquidity) > 0 {
+		return new(big.Int).Set(s.market.Liquidity)
+	}
+	return limit
+}
+
+// print writes the state in a short human-readable form.
+func (s *whatIfState) print(label string) {
+	fmt.Printf("%-28s deposit %s, shares %s, debt %s, health %s, utilization %s%%, max borrowable %s\n",
+		label, formatToken(s.pos.Deposit), s.pos.Shares, formatToken(s.pos.Debt()), formatHealth(s.pos.HealthFactor()),
+		new(big.Float).Mul(s.market.Utilization(), big.NewFloat(100)).Text('f', 2), formatToken(s.MaxBorrowable()))
+}
+
+// tokensToShares converts a token amount to deposit shares at a DepositIndex scaled by 1e18.
+func tokensToShares(amount, index *big.Int) *big.Int {
+	if index.Sign() == 0 {
+		return new(big.Int).Set(amount)
+	}
+	shares := new(big.Int).Mul(amount, big.NewInt(1e18))
+	return shares.Quo(shares, index)
+}
+
+// erc20Slot returns the storage slot of mapping[key] for a mapping declared at slot.
+func erc20Slot(key common.Hash, slot common.Hash) common.Hash {
+	return crypto.Keccak256Hash(key.Bytes(), slot.Bytes())
+}
+
+// simulateActions applies planned actions to a snapshot of a position and validates them via eth_call.
+func simulateActions(client *ethclient.Client, lending *defi.Defi, usdcToken *usdc.Usdc, head *types.Header, args []string) {
+	actionsCmd := flag.NewFlagSet("simulate", flag.ExitOnError)
+	addressFlag := actionsCmd.String("address", "", "Account whose position is simulated (e.g., 0x...)")
+	balanceSlotFlag := actionsCmd.Uint64("balance-slot", 0, "Storage slot of the uSDC balances mapping, used for state overrides")
+	allowanceSlotFlag := actionsCmd.Uint64("allowance-slot", 1, "Storage slot of the uSDC allowances mapping, used for state overrides")
+	fundFlag := actionsCmd.Bool("fund", false, "Override the account's uSDC balance so deposits and repayments are funded")
+	actionsCmd.Parse(args)
+
+	actions, err := parsePlannedActions(actionsCmd.Args())
+	if !common.IsHexAddress(*addressFlag) || err != nil || len(actions) == 0 {
+		if err != nil {
+			fmt.Println(err)
+		}
+		fmt.Println("Usage: simulate --address <address> [--fund] <action:amount>... (actions: deposit, withdraw, borrow, repay; amounts in whole tokens)")
+		os.Exit(1)
+	}
+	user := common.HexToAddress(*addressFlag)
+	ctx := context.Background()
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: head.Number}
+	pos, err := loadPosition(lending, opts, user)
+	if err != nil {
+		log.Fatal("Failed to read position:", err)
+	}
+	m, err := loadMarket(lending, usdcToken, opts)
+	if err != nil {
+		log.Fatal("Failed to read market:", err)
+	}
+
+	// Model the actions off-chain.
+	state := &whatIfState{pos: *pos, market: *m}
+	state.print("Current (block " + head.Number.String() + "):")
+	parsedABI, err := defi.DefiMetaData.GetAbi()
+	if err != nil {
+		log.Fatal("Failed to parse DeFiLending ABI:", err)
+	}
+	calls := make([][]byte, len(actions))
+	needed := new(big.Int)
+	for i, a := range actions {
+		arg, err := state.apply(a)
+		label := fmt.Sprintf("After %s %s:", a.Kind, formatToken(a.Amount))
+		if arg == nil {
+			fmt.Printf("%-28s cannot apply: %v\n", label, err)
+			os.Exit(1)
+		}
+		state.print(label)
+		if err != nil {
+			fmt.Printf("%-28s WARNING: %v\n", "", err)
+		}
+		if calls[i], err = parsedABI.Pack(a.Kind, arg); err != nil {
+			log.Fatal("Failed to encode call:", err)
+		}
+		if a.Kind == "deposit" || a.Kind == "repay" {
+			needed.Add(needed, a.Amount)
+		}
+	}
+
+	// Validate the real calls. The allowance is overridden because the CLI approves before
+	// depositing or repaying; the balance only with --fund.
+	lendingAddr := common.HexToAddress(contractAddress)
+	userKey := common.BytesToHash(user.Bytes())
+	diff := map[common.Hash]common.Hash{
+		erc20Slot(common.BytesToHash(lendingAddr.Bytes()), erc20Slot(userKey, common.BigToHash(new(big.Int).SetUint64(*allowanceSlotFlag)))): common.BigToHash(math.MaxBig256),
+	}
+	if *fundFlag {
+		balance, err := usdcToken.BalanceOf(opts, user)
+		if err != nil {
+			log.Fatal("Failed to get uSDC balance:", err)
+		}
+		diff[erc20Slot(userKey, common.BigToHash(new(big.Int).SetUint64(*balanceSlotFlag)))] = common.BigToHash(new(big.Int).Add(balance, needed))
+	}
+	overrides := map[common.Address]gethclient.OverrideAccount{
+		common.HexToAddress(usdcContractAddress): {StateDiff: diff},
+	}
+
+	fmt.Println("\nOn-chain validation:")
+	results, err := simulateCalls(ctx, client, user, lendingAddr, calls, overrides, head.Number)
+	if err != nil {
+		log.Fatal("Failed to simulate calls:", err)
+	}
+	for i, r := range results {
+		status := "ok"
+		if r != nil {
+			status = "REVERTS: " + r.Error()
+		}
+		fmt.Printf("  %d. %s %s: %s\n", i+1, actions[i].Kind, formatToken(actions[i].Amount), status)
+	}
+}
+
+// simulateCalls runs calls in sequence on top of a block with state overrides and returns one error per call.
+// It uses eth_simulateV1 so each call sees the effects of the previous ones, and falls back to independent
+// eth_calls when the node does not support it.
+func simulateCalls(ctx context.Context, client *ethclient.Client, from, to common.Address, calls [][]byte, overrides map[common.Address]gethclient.OverrideAccount, block *big.Int) ([]error, error) {
+	type simCall struct {
+		From  common.Address `json:"from"`
+		To    common.Address `json:"to"`
+		Input hexutil.Bytes  `json:"input"`
+	}
+	type simResult struct {
+		Status hexutil.Uint64 `json:"status"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	simCalls := make([]simCall, len(calls))
+	for i, data := range calls {
+		simCalls[i] = simCall{From: from, To: to, Input: data}
+	}
+	payload := map[string]interface{}{
+		"blockStateCalls": []map[string]interface{}{{"stateOverrides": overrides, "calls": simCalls}},
+	}
+	var blocks []struct {
+		Calls []simResult `json:"calls"`
+	}
+	err := client.Client().CallContext(ctx, &blocks, "eth_simulateV1", payload, hexutil.EncodeBig(block))
+	if err == nil && len(blocks) == 1 && len(blocks[0].Calls) == len(calls) {
+		results := make([]error, len(calls))
+		for i, r := range blocks[0].Calls {
+			if r.Status == 1 {
+				continue
+			}
+			results[i] = fmt.Errorf("execution reverted")
+			if r.Error != nil {
+				results[i] = fmt.Errorf("%s", r.Error.Message)
+			}
+		}
+		return results, nil
+	}
+
+	fmt.Println("  (eth_simulateV1 unavailable; each call is checked independently against current state)")
+	geth := gethclient.New(client.Client())
+	results := make([]error, len(calls))
+	for i, data := range calls {
+		_, results[i] = geth.CallContract(ctx, ethereum.CallMsg{From: from, To: &to, Data: data}, block, &overrides)
+	}
+	return results, nil
+}